@@ -0,0 +1,186 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"keep-vip/pkg/firewall"
+	"keep-vip/pkg/health"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"net"
+	"net/http"
+	"sort"
+)
+
+// Status - 节点状态, 通过管理接口查询
+type Status struct {
+	Cluster       string               `json:"cluster"`
+	ID            string               `json:"id"`
+	Address       string               `json:"address"`
+	State         string               `json:"state"`
+	Leader        string               `json:"leader"`
+	Score         int                  `json:"score"`
+	Holder        string               `json:"holder,omitempty"` // 放置模式的VIP持有者
+	Maintenance   *MaintenanceStatus   `json:"maintenance,omitempty"`
+	Freeze        *Freeze              `json:"freeze,omitempty"`
+	Members       []MemberHealth       `json:"members,omitempty"`
+	Groups        []GroupStatus        `json:"groups"`
+	Checks        []CheckStatus        `json:"checks"`
+	CheckGroups   []CheckGroupStatus   `json:"checkGroups,omitempty"`
+	Firewall      *firewall.Status     `json:"firewall,omitempty"`
+	LoadBalancers []LoadBalancerStatus `json:"loadBalancers,omitempty"`
+}
+
+// GroupStatus - 同步组状态
+type GroupStatus struct {
+	Name string      `json:"name"`
+	Vips []VipStatus `json:"vips"`
+}
+
+// CheckStatus - 检查状态
+type CheckStatus struct {
+	Protocol string `json:"protocol"`
+	Address  string `json:"address,omitempty"`
+	health.CheckStatus
+}
+
+// CheckGroupStatus - 检查组状态
+type CheckGroupStatus struct {
+	Name   string   `json:"name"`
+	Mode   string   `json:"mode"`
+	Checks []string `json:"checks"`
+	State  string   `json:"state"`
+}
+
+// VipStatus - VIP绑定状态
+type VipStatus struct {
+	Address   string `json:"address"`
+	Mode      string `json:"mode"`
+	Interface string `json:"interface"`
+	Netns     string `json:"netns,omitempty"`
+	Bound     bool   `json:"bound"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Status - 返回本节点状态
+func (c *Cluster) Status() Status {
+	status := Status{
+		Cluster:     setting.Config.Cluster,
+		ID:          c.LocalPeer.ID,
+		Address:     c.LocalPeer.Address.String(),
+		State:       c.raft.State().String(),
+		Score:       c.score(),
+		Maintenance: c.maintenanceStatus(),
+		Freeze:      c.stateMachine.Freeze(),
+	}
+	if c.placement() {
+		status.Holder = c.stateMachine.Holder()
+	}
+	if leaderAddr, leaderID := c.raft.LeaderWithID(); leaderID != "" {
+		status.Leader = fmt.Sprintf("%s (%s)", leaderID, leaderAddr)
+	}
+	for _, group := range c.VipGroups {
+		groupStatus := GroupStatus{Name: group.Name}
+		for _, vip := range group.Vips {
+			vipStatus := VipStatus{
+				Address:   vip.String(),
+				Mode:      vip.Mode(),
+				Interface: vip.Interface(),
+				Netns:     vip.Netns(),
+			}
+			bound, err := vip.IsExist()
+			if err != nil {
+				vipStatus.Error = err.Error()
+			}
+			vipStatus.Bound = bound
+			groupStatus.Vips = append(groupStatus.Vips, vipStatus)
+		}
+		status.Groups = append(status.Groups, groupStatus)
+	}
+	for _, check := range c.checks {
+		checkStatus, _ := c.scheduler.Store().Status(check.Name)
+		status.Checks = append(status.Checks, CheckStatus{
+			Protocol:    check.Protocol,
+			Address:     check.Address,
+			CheckStatus: checkStatus,
+		})
+	}
+	for _, group := range c.checkGroups {
+		status.CheckGroups = append(status.CheckGroups, CheckGroupStatus{
+			Name:   group.Name,
+			Mode:   group.combinator.String(),
+			Checks: group.Checks,
+			State:  c.state(group.Name).String(),
+		})
+	}
+	// 成员分数由Leader写入状态机
+	members := c.stateMachine.Members()
+	for _, member := range members {
+		status.Members = append(status.Members, member)
+	}
+	sort.Slice(status.Members, func(i, j int) bool {
+		return status.Members[i].ID < status.Members[j].ID
+	})
+	status.LoadBalancers = c.loadBalancerStatus()
+	if c.firewall != nil {
+		firewallStatus := c.firewall.Status()
+		status.Firewall = &firewallStatus
+	}
+	return status
+}
+
+// startAdmin - 启动管理接口
+func (c *Cluster) startAdmin() error {
+	if !setting.Config.Admin.Enabled {
+		return nil
+	}
+	listener, err := net.Listen("tcp", setting.Config.Admin.Address)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", c.handleStatus)
+	mux.HandleFunc("/v1/overrides", c.handleOverrides)
+	mux.HandleFunc("/v1/drain", c.handleDrain)
+	mux.HandleFunc("/v1/freeze", c.handleFreeze)
+	mux.HandleFunc("/v1/checks/", c.handleCheckOverride)
+	c.admin = &http.Server{Handler: mux}
+	go func() {
+		zlog.Info(fmt.Sprintf("Enabled admin api at: http://%s", listener.Addr().String()))
+		if err := c.admin.Serve(listener); err != nil && err != http.ErrServerClosed {
+			zlog.Error(errors.WithStack(err))
+		}
+	}()
+	return nil
+}
+
+// stopAdmin - 关闭管理接口
+func (c *Cluster) stopAdmin() {
+	if c.admin == nil {
+		return
+	}
+	if err := c.admin.Close(); err != nil {
+		zlog.Warn(err.Error())
+	}
+}
+
+func (c *Cluster) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, c.Status())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		zlog.Warn(err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
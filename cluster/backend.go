@@ -0,0 +1,280 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"keep-vip/pkg/health"
+	"keep-vip/pkg/loadbalancer"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultEjectTime - 被动检查默认摘除时间
+const DefaultEjectTime = 30 * time.Second
+
+// DefaultIdleTimeout - udp会话默认空闲超时
+const DefaultIdleTimeout = 30 * time.Second
+
+// DefaultMaxFlows - udp会话数默认上限, 避免伪造源地址的报文耗尽文件描述符
+const DefaultMaxFlows = 10000
+
+// DefaultRequestTimeout - http请求默认超时
+const DefaultRequestTimeout = 60 * time.Second
+
+// 拨号后端默认的重试策略
+const (
+	DefaultConnectTimeout = 500 * time.Millisecond
+	DefaultMaxAttempts    = 3
+	DefaultBackoff        = 100 * time.Millisecond
+	DefaultDeadline       = 3 * time.Second
+)
+
+// backendCheck - 负载均衡后端的主动检查
+type backendCheck struct {
+	lb      *loadbalancer.LoadBalancer
+	backend *loadbalancer.Backend
+	address string // 检查地址
+}
+
+// BackendStatus - 负载均衡后端状态
+type BackendStatus struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	Weight      int    `json:"weight"`
+	Connections int64  `json:"connections"`
+	Healthy     bool   `json:"healthy"`
+	Ejected     bool   `json:"ejected"`
+	Check       string `json:"check,omitempty"` // 主动检查状态
+}
+
+// LoadBalancerStatus - 负载均衡状态
+type LoadBalancerStatus struct {
+	Name      string          `json:"name"`
+	Algorithm string          `json:"algorithm"`
+	Backends  []BackendStatus `json:"backends"`
+}
+
+// backendJobName - 后端检查的名称
+func backendJobName(lb *loadbalancer.LoadBalancer, backend *loadbalancer.Backend) string {
+	return fmt.Sprintf("%s/%s", lb.Name, backend.Name)
+}
+
+// newPassive - 被动检查配置, ejectTime单位s
+func newPassive(maxFails, ejectTime int) loadbalancer.Passive {
+	passive := loadbalancer.Passive{MaxFails: maxFails, EjectTime: time.Second * time.Duration(ejectTime)}
+	if passive.EjectTime <= 0 {
+		passive.EjectTime = DefaultEjectTime
+	}
+	return passive
+}
+
+// newIdleTimeout - udp会话空闲超时, 单位s
+func newIdleTimeout(idleTimeout int) time.Duration {
+	if idleTimeout <= 0 {
+		return DefaultIdleTimeout
+	}
+	return time.Second * time.Duration(idleTimeout)
+}
+
+// newMaxFlows - udp会话数上限
+func newMaxFlows(maxFlows int) int {
+	if maxFlows <= 0 {
+		return DefaultMaxFlows
+	}
+	return maxFlows
+}
+
+// newHTTPOptions - http代理配置, timeout单位s
+func newHTTPOptions(timeout int, certFile, keyFile string) loadbalancer.HTTPOptions {
+	options := loadbalancer.HTTPOptions{
+		Timeout:  time.Second * time.Duration(timeout),
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultRequestTimeout
+	}
+	return options
+}
+
+// newBackends - 解析后端地址, 后端名称用于检查和监控, 不能为空且不能重复
+func newBackends(name string, backends []setting.Backend) ([]*loadbalancer.Backend, error) {
+	var lbBackends []*loadbalancer.Backend
+	names := make(map[string]bool, len(backends))
+	for _, backend := range backends {
+		if backend.Name == "" {
+			return nil, errors.Errorf("load balancer %s backend %s name cannot be blank", name, backend.Address)
+		}
+		if names[backend.Name] {
+			return nil, errors.Errorf("load balancer %s duplicate backend name: %s", name, backend.Name)
+		}
+		names[backend.Name] = true
+		address, err := net.ResolveTCPAddr("tcp", backend.Address)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		lbBackends = append(lbBackends, &loadbalancer.Backend{
+			Name:    backend.Name,
+			Address: address,
+			Weight:  backend.Weight,
+		})
+	}
+	return lbBackends, nil
+}
+
+// newRetry - 重试策略, 单位ms, 未配置使用默认值
+func newRetry(connectTimeout, maxAttempts, backoff, deadline int) loadbalancer.Retry {
+	retry := loadbalancer.Retry{
+		ConnectTimeout: time.Millisecond * time.Duration(connectTimeout),
+		MaxAttempts:    maxAttempts,
+		Backoff:        time.Millisecond * time.Duration(backoff),
+		Deadline:       time.Millisecond * time.Duration(deadline),
+	}
+	if retry.ConnectTimeout <= 0 {
+		retry.ConnectTimeout = DefaultConnectTimeout
+	}
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = DefaultMaxAttempts
+	}
+	if retry.Backoff <= 0 {
+		retry.Backoff = DefaultBackoff
+	}
+	if retry.Deadline <= 0 {
+		retry.Deadline = DefaultDeadline
+	}
+	return retry
+}
+
+// addBackendChecks - 为负载均衡的每个后端创建主动检查
+func (c *Cluster) addBackendChecks(lb *loadbalancer.LoadBalancer, template setting.Check) error {
+	if template.Protocol == "" {
+		return nil
+	}
+	interval := template.Interval
+	if interval <= 0 {
+		interval = setting.Config.ChecksInterval
+	}
+	if interval <= 0 {
+		return errors.Errorf("load balancer %s check interval must be greater than 0", lb.Name)
+	}
+	// 每个后端检查自己的地址, 配置了地址会让所有后端检查同一个目标
+	if template.Address != "" {
+		return errors.Errorf("load balancer %s check address must be empty, the backend address is used", lb.Name)
+	}
+	for _, backend := range lb.Backends {
+		check := template
+		check.Name = backendJobName(lb, backend)
+		check.Address = backend.Address.String()
+		// icmp只需要IP
+		if strings.ToLower(check.Protocol) == "icmp" {
+			check.Address = backend.Address.IP.String()
+		}
+		checker, err := newChecker(check)
+		if err != nil {
+			return errors.WithMessagef(err, "load balancer %s", lb.Name)
+		}
+		c.backendJobs = append(c.backendJobs, &health.Job{
+			Name:     check.Name,
+			Checker:  checker,
+			Interval: time.Second * time.Duration(interval),
+			Tracker:  health.NewTracker(check.Rise, check.Fall, time.Second*time.Duration(check.HoldDown)),
+		})
+		c.backendChecks = append(c.backendChecks, &backendCheck{lb: lb, backend: backend, address: check.Address})
+	}
+	return nil
+}
+
+// backendCheck - 根据名称返回后端检查
+func (c *Cluster) backendCheck(name string) *backendCheck {
+	for _, check := range c.backendChecks {
+		if backendJobName(check.lb, check.backend) == name {
+			return check
+		}
+	}
+	return nil
+}
+
+// onBackendResult - 更新后端主动检查状态, 在检查goroutine中调用
+func (c *Cluster) onBackendResult(result health.Result) {
+	check := c.backendCheck(result.Name)
+	if result.Err != nil {
+		zlog.Debug(fmt.Sprintf("Backend check %s failed: %s", result.Name, result.Err))
+		c.PromCheckFailure(result.Name, check.address, health.Reason(result.Err))
+	}
+	check.backend.SetFailing(result.State == health.StateFailing)
+	if result.Changed {
+		zlog.Warn(fmt.Sprintf("Load Balancer [%s] backend %s (%s) check state changed to %s",
+			check.lb.Name, check.backend.Name, check.backend.Address, result.State))
+	}
+	c.PromBackendHealthy(check.lb, check.backend)
+}
+
+// evaluateBackends - 在集群循环中定时调用, 更新所有后端的健康监控, 包括被动检查摘除的后端
+func (c *Cluster) evaluateBackends() {
+	for _, instance := range c.lbManager.LBInstances {
+		for _, lb := range instance.LoadBalancer.LoadBalancers() {
+			for _, backend := range lb.Backends {
+				c.PromBackendHealthy(lb, backend)
+			}
+		}
+	}
+}
+
+// loadBalancerStatus - 返回所有负载均衡后端的状态
+func (c *Cluster) loadBalancerStatus() []LoadBalancerStatus {
+	if c.lbManager == nil {
+		return nil
+	}
+	var statuses []LoadBalancerStatus
+	// http负载均衡的每个后端池单独显示
+	for _, instance := range c.lbManager.LBInstances {
+		for _, lb := range instance.LoadBalancer.LoadBalancers() {
+			status := LoadBalancerStatus{Name: lb.Name, Algorithm: lb.Algorithm}
+			for _, backend := range lb.Backends {
+				backendStatus := BackendStatus{
+					Name:        backend.Name,
+					Address:     backend.Address.String(),
+					Weight:      backend.Weight,
+					Connections: backend.Connections(),
+					Healthy:     backend.Healthy(),
+					Ejected:     backend.Ejected(),
+				}
+				if name := backendJobName(lb, backend); c.backendScheduler != nil && c.backendCheck(name) != nil {
+					backendStatus.Check = c.backendScheduler.Store().State(name).String()
+				}
+				status.Backends = append(status.Backends, backendStatus)
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+func (c *Cluster) PromBackendHealthy(lb *loadbalancer.LoadBalancer, backend *loadbalancer.Backend) {
+	var current float64
+	if backend.Healthy() {
+		current = 1
+	}
+	BackendHealthy.With(prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+		"lb":               lb.Name,
+		"backend":          backend.Name,
+		"address":          backend.Address.String(),
+	}).Set(current)
+}
+
+func (c *Cluster) PromConnectFailure(lb *loadbalancer.LoadBalancer, reason string) {
+	ConnectFailures.With(prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+		"lb":               lb.Name,
+		"reason":           reason,
+	}).Inc()
+}
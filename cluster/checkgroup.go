@@ -0,0 +1,177 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"keep-vip/pkg/health"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+)
+
+// checkGroup - 组合检查, 根据成员状态计算组状态
+type checkGroup struct {
+	Name       string
+	Checks     []string
+	combinator health.Combinator
+	state      health.State // 上次计算的状态, 只在集群循环中读写
+}
+
+// newCheckGroups - 创建组合检查, 校验成员、依赖是否存在以及是否有循环引用.
+// 加权检查只调整分数, 不能属于检查组, 否则failing时检查组failing会决定节点健康
+func newCheckGroups(checks []*nodeCheck) ([]*checkGroup, error) {
+	names := make(map[string]bool)
+	weighted := make(map[string]bool)
+	for _, check := range checks {
+		names[check.Name] = true
+		weighted[check.Name] = check.Weight != 0
+	}
+	var groups []*checkGroup
+	for _, confGroup := range setting.Config.CheckGroups {
+		if confGroup.Name == "" {
+			return nil, errors.New("check group name cannot be blank")
+		}
+		if names[confGroup.Name] {
+			return nil, errors.Errorf("duplicate check or check group name: %s", confGroup.Name)
+		}
+		names[confGroup.Name] = true
+		if len(confGroup.Checks) == 0 {
+			return nil, errors.Errorf("check group %s has no checks", confGroup.Name)
+		}
+		combinator, err := health.ParseCombinator(confGroup.Mode)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "check group %s", confGroup.Name)
+		}
+		if combinator.Kind == health.CombineQuorum && combinator.Quorum > len(confGroup.Checks) {
+			return nil, errors.Errorf("check group %s quorum %d is greater than the number of checks %d",
+				confGroup.Name, combinator.Quorum, len(confGroup.Checks))
+		}
+		for _, member := range confGroup.Checks {
+			if weighted[member] {
+				return nil, errors.Errorf("check group %s cannot contain weighted check %s", confGroup.Name, member)
+			}
+		}
+		groups = append(groups, &checkGroup{
+			Name:       confGroup.Name,
+			Checks:     confGroup.Checks,
+			combinator: combinator,
+		})
+	}
+
+	// 组成员和依赖构成的引用关系
+	refs := make(map[string][]string)
+	for _, group := range groups {
+		refs[group.Name] = append(refs[group.Name], group.Checks...)
+	}
+	for _, check := range checks {
+		refs[check.Name] = append(refs[check.Name], check.DependsOn...)
+	}
+	for name, targets := range refs {
+		for _, target := range targets {
+			if !names[target] {
+				return nil, errors.Errorf("%s references unknown check: %s", name, target)
+			}
+		}
+	}
+	// 深度优先查找循环引用
+	visiting, visited := make(map[string]bool), make(map[string]bool)
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visiting[name] {
+			return errors.Errorf("circular check reference: %s", name)
+		}
+		if visited[name] {
+			return nil
+		}
+		visiting[name] = true
+		for _, target := range refs[name] {
+			if err := visit(target); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		visited[name] = true
+		return nil
+	}
+	for name := range refs {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// checkGroup - 根据名称返回组合检查
+func (c *Cluster) checkGroup(name string) *checkGroup {
+	for _, group := range c.checkGroups {
+		if group.Name == name {
+			return group
+		}
+	}
+	return nil
+}
+
+// state - 返回检查或检查组的状态
+func (c *Cluster) state(name string) health.State {
+	group := c.checkGroup(name)
+	if group == nil {
+		return c.scheduler.Store().State(name)
+	}
+	states := make([]health.State, 0, len(group.Checks))
+	for _, member := range group.Checks {
+		states = append(states, c.state(member))
+	}
+	return group.combinator.Combine(states)
+}
+
+// dependencyDown - 依赖的检查或检查组任意一个failing时返回true
+func (c *Cluster) dependencyDown(check *nodeCheck) bool {
+	for _, name := range check.DependsOn {
+		if c.state(name) == health.StateFailing {
+			return true
+		}
+	}
+	return false
+}
+
+// decisions - 决定节点健康的检查和检查组: 不属于任何检查组的检查和检查组, 以及同步组跟踪的检查.
+// 放置模式的放置检查在非持有者上按设计为failing, 只用于选择VIP持有者, 不决定节点健康
+func (c *Cluster) decisions() []string {
+	members := make(map[string]bool)
+	for _, group := range c.checkGroups {
+		for _, name := range group.Checks {
+			members[name] = true
+		}
+	}
+	var names []string
+	added := make(map[string]bool)
+	add := func(name string) {
+		if c.placement() && name == setting.Config.PlacementCheck {
+			return
+		}
+		if !added[name] && (!members[name] || c.trackedGroup(name) != nil) {
+			added[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, check := range c.checks {
+		add(check.Name)
+	}
+	for _, group := range c.checkGroups {
+		add(group.Name)
+	}
+	return names
+}
+
+// evaluateCheckGroups - 在集群循环中调用, 记录检查组状态变化的日志和监控
+func (c *Cluster) evaluateCheckGroups() {
+	for _, group := range c.checkGroups {
+		state := c.state(group.Name)
+		if state == group.state {
+			continue
+		}
+		zlog.Warn(fmt.Sprintf("Check group %s state changed to %s", group.Name, state))
+		group.state = state
+		c.PromCheckState(group.Name, "", state)
+		c.PromCheckTransition(group.Name, "")
+	}
+}
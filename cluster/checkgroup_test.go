@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"keep-vip/pkg/health"
+	"keep-vip/setting"
+	"testing"
+)
+
+func TestNewCheckGroups(t *testing.T) {
+	checks := []setting.Check{{Name: "web"}, {Name: "dns"}, {Name: "disk", Weight: -20}}
+	tests := []struct {
+		name    string
+		groups  string
+		wantErr bool
+	}{
+		{name: "valid", groups: `
+  - name: node
+    checks: [web, dns]`},
+		{name: "nested", groups: `
+  - name: backend
+    mode: any
+    checks: [dns]
+  - name: node
+    checks: [web, backend]`},
+		{name: "weighted member", groups: `
+  - name: node
+    checks: [web, disk]`, wantErr: true},
+		{name: "unknown member", groups: `
+  - name: node
+    checks: [web, db]`, wantErr: true},
+		{name: "duplicate name", groups: `
+  - name: web
+    checks: [dns]`, wantErr: true},
+		{name: "circular", groups: `
+  - name: a
+    checks: [b]
+  - name: b
+    checks: [a]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		loadConfig(t, "checkGroups:"+tt.groups)
+		c := newTestCluster(t, checks...)
+		if _, err := newCheckGroups(c.checks); (err != nil) != tt.wantErr {
+			t.Errorf("%s: newCheckGroups error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestWeightedCheckOnlyAdjustsScore(t *testing.T) {
+	loadConfig(t, `
+checkGroups:
+  - name: node
+    checks: [web]
+`)
+	c := newTestCluster(t, setting.Check{Name: "web"}, setting.Check{Name: "disk", Weight: -20})
+	groups, err := newCheckGroups(c.checks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.checkGroups = groups
+	setState(t, c, "web", health.StatePassing)
+	setState(t, c, "disk", health.StateFailing)
+	if !c.healthy() {
+		t.Fatal("failing weighted check made the node unhealthy")
+	}
+	if score := c.score(); score != 80 {
+		t.Fatalf("score = %d, want 80", score)
+	}
+	setState(t, c, "web", health.StateFailing)
+	if c.healthy() {
+		t.Fatal("failing check group did not make the node unhealthy")
+	}
+}
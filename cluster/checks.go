@@ -0,0 +1,307 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"keep-vip/pkg/health"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"os"
+	"strings"
+	"time"
+)
+
+// nodeCheck - 节点检查及其状态
+type nodeCheck struct {
+	setting.Check
+	checker  health.Checker
+	tracker  *health.Tracker
+	interval time.Duration
+}
+
+// newCheckers - 创建节点检查, 检查名称不能重复
+func newCheckers() ([]*nodeCheck, error) {
+	var checks []*nodeCheck
+	names := make(map[string]bool)
+	for _, check := range setting.Config.Checks {
+		if check.Name == "" {
+			return nil, errors.New("check name cannot be blank")
+		}
+		if names[check.Name] {
+			return nil, errors.Errorf("duplicate check name: %s", check.Name)
+		}
+		names[check.Name] = true
+		interval := check.Interval
+		if interval <= 0 {
+			interval = setting.Config.ChecksInterval
+		}
+		if interval <= 0 {
+			return nil, errors.Errorf("check %s interval must be greater than 0", check.Name)
+		}
+		// 同一个检查同时最多执行一次, 超时时间大于间隔只会推迟下一次检查
+		if check.Timeout >= interval {
+			zlog.Warn(fmt.Sprintf("Check %s timeout %ds is not less than interval %ds, a slow check delays the next one",
+				check.Name, check.Timeout, interval))
+		}
+		checker, err := newChecker(check)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, &nodeCheck{
+			Check:    check,
+			checker:  checker,
+			tracker:  health.NewTracker(check.Rise, check.Fall, time.Second*time.Duration(check.HoldDown)),
+			interval: time.Second * time.Duration(interval),
+		})
+	}
+	return checks, nil
+}
+
+// newScheduler - 创建检查调度
+func (c *Cluster) newScheduler() *health.Scheduler {
+	var jobs []*health.Job
+	for _, check := range c.checks {
+		job := &health.Job{
+			Name:     check.Name,
+			Checker:  check.checker,
+			Interval: check.interval,
+			Tracker:  check.tracker,
+		}
+		if len(check.DependsOn) > 0 {
+			check := check
+			job.Skip = func() bool {
+				return c.dependencyDown(check)
+			}
+		}
+		jobs = append(jobs, job)
+	}
+	return health.NewScheduler(jobs, c.onCheckResult)
+}
+
+// check - 根据名称返回节点检查
+func (c *Cluster) check(name string) *nodeCheck {
+	for _, check := range c.checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return nil
+}
+
+// onCheckResult - 记录检查结果的日志和监控, 在检查goroutine中调用
+func (c *Cluster) onCheckResult(result health.Result) {
+	check := c.check(result.Name)
+	zlog.Debug(fmt.Sprintf("Check %s finished in %s", check.Name, result.Duration))
+	if result.Err != nil {
+		zlog.Error(errors.WithMessagef(result.Err, "check %s failed", check.Name))
+		c.PromCheckFailure(check.Name, check.Address, health.Reason(result.Err))
+		c.PromCheckPort(check.Name, check.Address, 0)
+	} else {
+		c.PromCheckPort(check.Name, check.Address, 1)
+	}
+	c.PromCheckState(check.Name, check.Address, result.State)
+	if tlsChecker, ok := check.checker.(*health.TLSChecker); ok && !tlsChecker.NotAfter().IsZero() {
+		c.PromCertNotAfter(check.Name, check.Address, tlsChecker.NotAfter())
+	}
+	if result.Changed {
+		zlog.Warn(fmt.Sprintf("Check %s state changed to %s", check.Name, result.State))
+		c.PromCheckTransition(check.Name, check.Address)
+	}
+}
+
+// evaluateChecks - 在集群循环中调用. 如果是Leader且检查或检查组状态为failing, 转移Leader到健康的成员, 加权检查只调整分数.
+// 没有成员上报健康状态时, 同步组跟踪的检查整组迁移, 其他检查退出程序. 返回true表示已经放弃Leader
+func (c *Cluster) evaluateChecks(isLeader bool) bool {
+	c.evaluateOverrides()
+	c.evaluateCheckGroups()
+	// 集群冻结期间检查不触发Leader转移和VIP释放
+	if !isLeader || c.exiting || c.frozen() {
+		return c.exiting
+	}
+	for _, name := range c.decisions() {
+		if c.state(name) != health.StateFailing {
+			continue
+		}
+		reason := errors.Errorf("check %s is failing", name)
+		if group := c.trackedGroup(name); group != nil {
+			return c.failover(group, reason)
+		}
+		if c.weighted(name) {
+			continue
+		}
+		return c.handoff(reason, func() {
+			c.exit(reason)
+		})
+	}
+	return false
+}
+
+// weighted - 是否为加权检查, 加权检查failing只调整节点分数
+func (c *Cluster) weighted(name string) bool {
+	check := c.check(name)
+	return check != nil && check.Weight != 0
+}
+
+// exit - 停止集群并退出程序. 在新的goroutine中执行, 避免集群循环等待自己结束
+func (c *Cluster) exit(reason error) {
+	zlog.Error(errors.WithMessage(reason, "exiting"))
+	c.exiting = true
+	go func() {
+		c.Stop()
+		os.Exit(1)
+	}()
+}
+
+// newChecker - 根据协议创建检查, 不支持的协议返回错误
+func newChecker(check setting.Check) (health.Checker, error) {
+	var (
+		checker health.Checker
+		err     error
+	)
+	switch protocol := strings.ToLower(check.Protocol); protocol {
+	case "tcp":
+		checker = &health.TCPChecker{Address: check.Address, Timeout: check.Timeout}
+	case "http", "https":
+		checker, err = health.NewHTTPChecker(health.HTTPOptions{
+			Address:      check.Address,
+			HTTPS:        protocol == "https",
+			Method:       check.HTTP.Method,
+			Path:         check.HTTP.Path,
+			Host:         check.HTTP.Host,
+			Headers:      check.HTTP.Headers,
+			ExpectStatus: check.HTTP.ExpectStatus,
+			BodyContains: check.HTTP.BodyContains,
+			BodyRegex:    check.HTTP.BodyRegex,
+			TLS:          health.TLSOptions(check.HTTP.TLS),
+			Timeout:      check.Timeout,
+		})
+	case "exec":
+		checker, err = health.NewExecChecker(health.ExecOptions{
+			Name:      check.Name,
+			Command:   check.Exec.Command,
+			Args:      check.Exec.Args,
+			Env:       check.Exec.Env,
+			Dir:       check.Exec.Dir,
+			MaxOutput: check.Exec.MaxOutput,
+			Timeout:   check.Timeout,
+		})
+	case "udp":
+		checker, err = health.NewUDPChecker(health.UDPOptions{
+			Address:        check.Address,
+			Payload:        check.UDP.Payload,
+			PayloadHex:     check.UDP.PayloadHex,
+			ExpectReply:    check.UDP.ExpectReply,
+			ExpectContains: check.UDP.ExpectContains,
+			Timeout:        check.Timeout,
+		})
+	case "dns":
+		checker, err = health.NewDNSChecker(health.DNSOptions{
+			Server:  check.Address,
+			Name:    check.DNS.Name,
+			Type:    check.DNS.Type,
+			Expect:  check.DNS.Expect,
+			Timeout: check.Timeout,
+		})
+	case "icmp":
+		checker, err = health.NewICMPChecker(health.ICMPOptions{
+			Address: check.Address,
+			Count:   check.ICMP.Count,
+			MaxLoss: check.ICMP.MaxLoss,
+			MaxRtt:  check.ICMP.MaxRtt,
+			Timeout: check.Timeout,
+		})
+	case "grpc":
+		checker, err = health.NewGRPCChecker(health.GRPCOptions{
+			Address:   check.Address,
+			Service:   check.GRPC.Service,
+			TLS:       check.GRPC.TLS,
+			TLSConfig: health.TLSOptions(check.GRPC.TLSConfig),
+			Timeout:   check.Timeout,
+		})
+	case "tls":
+		checker, err = health.NewTLSChecker(health.TLSCheckOptions{
+			Name:    check.Name,
+			Address: check.Address,
+			TLS: health.TLSOptions{
+				InsecureSkipVerify: check.TLS.InsecureSkipVerify,
+				ServerName:         check.TLS.ServerName,
+				CaFile:             check.TLS.CaFile,
+				CertFile:           check.TLS.CertFile,
+				KeyFile:            check.TLS.KeyFile,
+			},
+			WarnDays: check.TLS.WarnDays,
+			FailDays: check.TLS.FailDays,
+			Timeout:  check.Timeout,
+		})
+	case "postgres", "mysql", "redis":
+		options := health.DatabaseOptions{
+			Address:  check.Address,
+			User:     check.Database.User,
+			Password: check.Database.Password,
+			Database: check.Database.Database,
+			Role:     check.Database.Role,
+			SSLMode:  check.Database.SSLMode,
+			Timeout:  check.Timeout,
+		}
+		switch protocol {
+		case "postgres":
+			checker, err = health.NewPostgresChecker(options)
+		case "mysql":
+			checker, err = health.NewMySQLChecker(options)
+		default:
+			checker, err = health.NewRedisChecker(options)
+		}
+	default:
+		return nil, errors.Errorf(
+			"Check port %s the protocol type is not supported: %s",
+			check.Name,
+			check.Protocol,
+		)
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(err, "check %s", check.Name)
+	}
+	return checker, nil
+}
+
+func (c *Cluster) PromCheckState(name, address string, state health.State) {
+	CheckState.With(prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+		"name":             name,
+		"address":          address,
+	}).Set(float64(state))
+}
+
+func (c *Cluster) PromCertNotAfter(name, address string, notAfter time.Time) {
+	CertNotAfter.With(prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+		"name":             name,
+		"address":          address,
+	}).Set(float64(notAfter.Unix()))
+}
+
+func (c *Cluster) PromCheckTransition(name, address string) {
+	CheckTransitions.With(prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+		"name":             name,
+		"address":          address,
+	}).Inc()
+}
+
+func (c *Cluster) PromCheckFailure(name, address, reason string) {
+	CheckFailures.With(prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+		"name":             name,
+		"address":          address,
+		"reason":           reason,
+	}).Inc()
+}
@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"errors"
+	"keep-vip/pkg/health"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	zlog.NewZapLog("error", "console")
+	os.Exit(m.Run())
+}
+
+// baseConfig - 没有加载配置文件时的配置
+var baseConfig = setting.Config
+
+// loadConfig - 从yaml加载配置, 测试结束后恢复
+func loadConfig(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setting.Config = baseConfig
+	t.Cleanup(func() { setting.Config = baseConfig })
+	if err := setting.LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestCluster - 创建只有节点检查的集群, 检查不执行, 通过setState设置状态
+func newTestCluster(t *testing.T, checks ...setting.Check) *Cluster {
+	t.Helper()
+	c := &Cluster{LocalPeer: RaftPeer{ID: "s1", Address: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 20000}, Priority: 100}}
+	for _, check := range checks {
+		c.checks = append(c.checks, &nodeCheck{
+			Check:    check,
+			tracker:  health.NewTracker(1, 1, 0),
+			interval: time.Second,
+		})
+	}
+	c.scheduler = c.newScheduler()
+	return c
+}
+
+// setState - 设置检查状态, rise和fall为1
+func setState(t *testing.T, c *Cluster, name string, state health.State) {
+	t.Helper()
+	check := c.check(name)
+	if check == nil {
+		t.Fatalf("unknown check %s", name)
+	}
+	var err error
+	if state == health.StateFailing {
+		err = errors.New("check failed")
+	}
+	if got, _ := check.tracker.Record(err); got != state {
+		t.Fatalf("check %s state = %s, want %s", name, got, state)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"keep-vip/pkg/firewall"
+	"keep-vip/pkg/health"
 	"keep-vip/pkg/loadbalancer"
 	"keep-vip/pkg/network"
 	"keep-vip/pkg/zlog"
@@ -14,22 +16,43 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"strings"
 	"time"
 )
 
 type Cluster struct {
-	RemotePeers  []RaftPeer
-	LocalPeer    RaftPeer
-	Vip          network.Vip
-	stateMachine FSM
-	stop         chan bool
-	completed    chan bool
+	RemotePeers      []RaftPeer
+	LocalPeer        RaftPeer
+	VipGroups        []*network.VipGroup
+	raft             *raft.Raft
+	firewall         *firewall.Nftables
+	checks           []*nodeCheck
+	checkGroups      []*checkGroup
+	scheduler        *health.Scheduler
+	exiting          bool // 只在集群循环中读写
+	admin            *http.Server
+	peer             *http.Server
+	stateMachine     *FSM
+	holderCleared    time.Time                  // 放置模式清空持有者的时间, 只在集群循环中读写
+	overrides        map[string]health.Override // 上次记录的检查覆盖, 只在集群循环中读写
+	drain            drainState
+	inMaintenance    bool // 上次记录的维护状态, 只在集群循环中读写
+	wasFrozen        bool // 上次记录的集群冻结状态, 只在集群循环中读写
+	lbManager        *loadbalancer.LBManager
+	backendJobs      []*health.Job
+	backendChecks    []*backendCheck
+	backendScheduler *health.Scheduler
+	peers            peerCache
+	outscoredBy      string    // 分数高于本节点的成员, 只在集群循环中读写
+	outscoredSince   time.Time // 成员分数开始高于本节点的时间, 只在集群循环中读写
+	stop             chan bool
+	completed        chan bool
 }
 
 type RaftPeer struct {
-	ID      string       // 集群内唯一标识
-	Address *net.TCPAddr // IP地址
+	ID         string       // 集群内唯一标识
+	Address    *net.TCPAddr // IP地址
+	Priority   int          // 节点优先级
+	APIAddress string       // 成员接口地址
 }
 
 const RaftClusterNamespace = "keep_vip"
@@ -51,10 +74,65 @@ var (
 		Name:      "check_port",
 		Help:      "Raft cluster check port. return 1 is success, 0 failure",
 	}, append(labels, "name", "address"))
+	FirewallInstalled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "firewall_installed",
+		Help:      "Whether or not the nftables rules are installed. 1 if is, 0 otherwise",
+	}, append(labels, "table"))
+	CheckState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "check_state",
+		Help:      "Check state after rise/fall, return Unknown:0 Passing:1 Failing:2",
+	}, append(labels, "name", "address"))
+	CheckTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "check_transitions_total",
+		Help:      "Number of check state transitions",
+	}, append(labels, "name", "address"))
+	CheckFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "check_failures_total",
+		Help:      "Number of failed checks by reason",
+	}, append(labels, "name", "address", "reason"))
+	StaleVipsRemoved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "stale_vips_removed_total",
+		Help:      "Number of leftover vips removed at startup",
+	}, labels)
+	CertNotAfter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "tls_cert_not_after_seconds",
+		Help:      "Unix time when the certificate presented to the tls check expires",
+	}, append(labels, "name", "address"))
+	CheckOverride = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "check_override_expires_seconds",
+		Help:      "Unix time when the manual override of the check expires",
+	}, append(labels, "name", "address", "mode"))
+	MemberMaintenance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "member_maintenance",
+		Help:      "Whether or not this member is in maintenance. 1 if is, 0 otherwise",
+	}, labels)
+	BackendHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "lb_backend_healthy",
+		Help:      "Whether or not the load balancer backend is healthy. 1 if is, 0 if failing or ejected",
+	}, append(labels, "lb", "backend", "address"))
+	ConnectFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "lb_connect_failures_total",
+		Help:      "Number of client connections closed because no backend could be dialed",
+	}, append(labels, "lb", "reason"))
+	MemberScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: RaftClusterNamespace,
+		Name:      "member_score",
+		Help:      "Member priority adjusted by weighted checks",
+	}, labels)
 )
 
 func InitCluster() (*Cluster, error) {
-	if setting.Config.VIP == "" {
+	if setting.Config.VIP == "" && len(setting.Config.SyncGroups) == 0 {
 		return nil, errors.New("vip address config is empty")
 	}
 
@@ -69,6 +147,17 @@ func InitCluster() (*Cluster, error) {
 			MemberIsLeader,
 			MemberState,
 			CheckPort,
+			CheckState,
+			CheckTransitions,
+			CheckFailures,
+			FirewallInstalled,
+			StaleVipsRemoved,
+			MemberScore,
+			CertNotAfter,
+			CheckOverride,
+			MemberMaintenance,
+			BackendHealthy,
+			ConnectFailures,
 		)
 		http.Handle("/metrics", promhttp.Handler())
 		tcpAddress, err := net.ResolveTCPAddr("tcp", setting.Config.Prometheus.Address)
@@ -83,13 +172,21 @@ func InitCluster() (*Cluster, error) {
 		}()
 	}
 
-	vip, err := network.NewVip(setting.Config.VIP, setting.Config.Interface)
+	groups, err := newVipGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	nftables, err := newFirewall()
 	if err != nil {
 		return nil, err
 	}
 
 	return &Cluster{
-		Vip: vip,
+		VipGroups:    groups,
+		firewall:     nftables,
+		stateMachine: NewFSM(),
+		drain:        drainState{changes: make(chan struct{}, 1)},
 	}, nil
 }
 
@@ -114,6 +211,10 @@ func (c *Cluster) StartRaftCluster(logLevel string) error {
 	if err := c.ClassifyRaftPeer(); err != nil {
 		return err
 	}
+	// 加入集群前清理上次异常退出残留的VIP
+	if err := c.cleanStaleVips(); err != nil {
+		return err
+	}
 	// 本机Raft配置
 	raftConfig := raft.DefaultConfig()
 	raftConfig.LogLevel = ParseLevel(logLevel).String()
@@ -151,11 +252,37 @@ func (c *Cluster) StartRaftCluster(logLevel string) error {
 		return errors.WithStack(err)
 	}
 
+	// 创建检查
+	checks, err := newCheckers()
+	if err != nil {
+		return err
+	}
+	c.checks = checks
+	checkGroups, err := newCheckGroups(checks)
+	if err != nil {
+		return err
+	}
+	c.checkGroups = checkGroups
+	if err := c.checkPlacement(); err != nil {
+		return err
+	}
+	c.scheduler = c.newScheduler()
+
 	// 创建Raft
 	raftServer, err := raft.NewRaft(raftConfig, c.stateMachine, logStore, stableStore, snapshots, transport)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	c.raft = raftServer
+
+	// 管理接口
+	if err := c.startAdmin(); err != nil {
+		return err
+	}
+	// 成员接口
+	if err := c.startPeer(); err != nil {
+		return err
+	}
 	zlog.Info("This instance will wait approximately 5 seconds, from cold start to ensure cluster elections are complete")
 	time.Sleep(time.Second * 5)
 
@@ -169,23 +296,56 @@ func (c *Cluster) StartRaftCluster(logLevel string) error {
 		lb := &loadbalancer.LoadBalancer{
 			Name:        confLB.Name,
 			Type:        confLB.Type,
+			Algorithm:   confLB.Algorithm,
 			BindAddress: bindAddress,
+			Passive:     newPassive(confLB.Passive.MaxFails, confLB.Passive.EjectTime),
+			Retry: newRetry(confLB.Retry.ConnectTimeout, confLB.Retry.MaxAttempts,
+				confLB.Retry.Backoff, confLB.Retry.Deadline),
+			IdleTimeout:      newIdleTimeout(confLB.IdleTimeout),
+			MaxFlows:         newMaxFlows(confLB.MaxFlows),
+			HTTP:             newHTTPOptions(confLB.HTTP.Timeout, confLB.HTTP.CertFile, confLB.HTTP.KeyFile),
+			OnConnectFailure: c.PromConnectFailure,
+		}
+		if lb.Backends, err = newBackends(lb.Name, confLB.Backends); err != nil {
+			return err
 		}
-		for _, backend := range confLB.Backends {
-			address, err := net.ResolveTCPAddr("tcp", backend.Address)
-			if err != nil {
-				return errors.WithStack(err)
+		// 后端池名称为 负载均衡/后端池, 使用负载均衡的检查和重试策略
+		for _, confPool := range confLB.Pools {
+			pool := &loadbalancer.LoadBalancer{
+				Name:      fmt.Sprintf("%s/%s", confLB.Name, confPool.Name),
+				Type:      confLB.Type,
+				Algorithm: confPool.Algorithm,
+				Passive:   lb.Passive,
+				Retry:     lb.Retry,
+			}
+			if pool.Backends, err = newBackends(pool.Name, confPool.Backends); err != nil {
+				return err
+			}
+			lb.Pools = append(lb.Pools, pool)
+		}
+		for _, confRoute := range confLB.Routes {
+			route := loadbalancer.Route{Host: confRoute.Host, Path: confRoute.Path}
+			if confRoute.Pool != "" {
+				route.Pool = fmt.Sprintf("%s/%s", confLB.Name, confRoute.Pool)
+			}
+			lb.Routes = append(lb.Routes, route)
+		}
+		for _, target := range lb.LoadBalancers() {
+			if err := c.addBackendChecks(target, confLB.Check); err != nil {
+				return err
 			}
-			lb.Backends = append(lb.Backends, &loadbalancer.Backend{
-				Name:    backend.Name,
-				Address: address,
-			})
 		}
 		if err := lbManager.AddLoadBalancer(lb); err != nil {
 			return err
 		}
-		zlog.Info(fmt.Sprintf("Load Balancer [%s] started, connection address: %s:%d",
-			lb.Name, c.Vip.String(), bindAddress.Port))
+		zlog.Info(fmt.Sprintf("Load Balancer [%s] started, connection address: %s port %d",
+			lb.Name, c.vipString(), bindAddress.Port))
+	}
+	c.lbManager = &lbManager
+	// 负载均衡后端主动检查
+	if len(c.backendJobs) > 0 {
+		c.backendScheduler = health.NewScheduler(c.backendJobs, c.onBackendResult)
+		c.backendScheduler.Start()
 	}
 
 	// 检查集群状态
@@ -193,6 +353,8 @@ func (c *Cluster) StartRaftCluster(logLevel string) error {
 	c.stop = make(chan bool, 1)
 	c.completed = make(chan bool, 1)
 	var isLeader bool
+	c.scheduler.Start()
+	c.startCollector()
 	go func() {
 		for {
 			select {
@@ -201,23 +363,47 @@ func (c *Cluster) StartRaftCluster(logLevel string) error {
 				if leader {
 					zlog.Info("This node is Leader of the cluster")
 					isLeader = true
-					// 添加VIP
-					if err := c.Vip.AddVIP(); err != nil {
-						zlog.Warn(err.Error())
+					// 维护中的节点不能成为Leader
+					if c.evaluateMaintenance(isLeader) {
+						continue
 					}
-					// 广播ARP
-					if err := network.ARPSendGratuitous(c.Vip.String(), c.Vip.Interface()); err != nil {
-						zlog.Warn(err.Error())
+					// 本节点检查失败时直接转移给健康的成员, 不绑定VIP
+					if c.evaluateChecks(isLeader) {
+						continue
 					}
-					c.PromMemberIsLeader(1)
+					if c.placement() {
+						// 放置模式由Leader分配VIP持有者
+						c.evaluatePlacement(isLeader)
+						continue
+					}
+					// 添加VIP, 广播ARP
+					c.acquireVips()
 				} else {
 					isLeader = false
 					zlog.Info("This node is becoming a follower within the cluster")
-					// 删除VIP
-					if err := c.Vip.DeleteVIP(); err != nil {
-						zlog.Warn(err.Error())
+					if c.placement() {
+						c.evaluatePlacement(isLeader)
+						continue
 					}
-					c.PromMemberIsLeader(0)
+					// 删除VIP
+					c.releaseVips()
+				}
+			case <-c.scheduler.Changes():
+				// 检查状态变化, 立即处理
+				c.evaluateChecks(isLeader)
+				if c.placement() {
+					c.evaluatePlacement(isLeader)
+				}
+			case <-c.drain.changes:
+				// 通过管理接口设置或清除排空, 立即处理
+				c.evaluateMaintenance(isLeader)
+				if c.placement() {
+					c.evaluatePlacement(isLeader)
+				}
+			case <-c.stateMachine.Changes():
+				// VIP持有者变化, 立即绑定或释放VIP
+				if c.placement() {
+					c.placeVips()
 				}
 			case <-ticker.C:
 				// 定时检查, 如果节点是Leader, VIP没有绑定则添加VIP, 发送ARP
@@ -227,23 +413,20 @@ func (c *Cluster) StartRaftCluster(logLevel string) error {
 					zlog.Debug("Leader is " + string(leaderAddr))
 				}
 				// Check VIP
-				if c.LocalPeer.Address.String() == string(leaderAddr) && c.LocalPeer.ID == string(leaderID) {
-					isLeader = true
-					// 添加VIP
-					if err := c.Vip.AddVIP(); err != nil {
-						zlog.Warn(err.Error())
-					}
-					// 广播ARP
-					if err := network.ARPSendGratuitous(c.Vip.String(), c.Vip.Interface()); err != nil {
-						zlog.Error(err)
-					}
-					c.PromMemberIsLeader(1)
-				} else {
-					isLeader = false
-					if err := c.Vip.DeleteVIP(); err != nil {
-						zlog.Warn(err.Error())
-					}
-					c.PromMemberIsLeader(0)
+				isLeader = c.LocalPeer.Address.String() == string(leaderAddr) && c.LocalPeer.ID == string(leaderID)
+				// 集群冻结期间输出警告
+				c.evaluateFreeze()
+				// 维护文件存在或者设置了排空, 释放VIP并转移Leader
+				c.evaluateMaintenance(isLeader)
+				switch {
+				case c.placement():
+					// 放置模式根据状态机中的持有者绑定VIP
+					c.evaluatePlacement(isLeader)
+				case isLeader:
+					// 添加VIP, 广播ARP
+					c.acquireVips()
+				default:
+					c.releaseVips()
 				}
 
 				// Prom State
@@ -256,51 +439,34 @@ func (c *Cluster) StartRaftCluster(logLevel string) error {
 					c.PromMemberState(2)
 				}
 
-				// Check Port
-				for _, check := range setting.Config.Checks {
-					check := check
-					go func() {
-						zlog.Info("Open check port: " + check.Name)
-						switch strings.ToLower(check.Protocol) {
-						case "tcp":
-							if check.Timeout > setting.Config.ChecksInterval {
-								check.Timeout = 0
-							}
-							if err := network.CheckTcpAddress(check.Address, check.Timeout); err != nil {
-								zlog.Error(err)
-								// 如果是Leader, 则退出程序
-								if isLeader {
-									c.Stop()
-									os.Exit(1)
-								}
-								// Prom
-								c.PromCheckPort(check.Name, check.Address, 0)
-							} else {
-								// Prom
-								c.PromCheckPort(check.Name, check.Address, 1)
-							}
-						default:
-							zlog.Error(errors.Errorf(
-								"Check port %s the protocol type is not supported: %s",
-								check.Name,
-								check.Protocol,
-							))
-						}
-					}()
-				}
-				// TODO Check LB Backend
+				// Check Port, 检查由调度独立执行, 这里只读取状态
+				c.evaluateChecks(isLeader)
+				// 节点分数, 有分数更高的成员时转移Leader
+				c.evaluateScores(isLeader)
+				// 负载均衡后端健康监控
+				c.evaluateBackends()
 
 			case <-c.stop:
 				leaderAddr, leaderID := raftServer.LeaderWithID()
-				if c.LocalPeer.Address.String() == string(leaderAddr) && c.LocalPeer.ID == string(leaderID) {
+				if c.LocalPeer.Address.String() == string(leaderAddr) && c.LocalPeer.ID == string(leaderID) || c.placement() {
 					// 删除VIP
-					if err := c.Vip.DeleteVIP(); err != nil {
-						zlog.Warn(err.Error())
-					}
+					c.releaseVips()
 				}
 
+				// 关闭管理接口
+				c.stopAdmin()
+				c.stopPeer()
+				c.stopCollector()
+
+				// 停止检查
+				zlog.Info("Stopping Checks")
+				c.scheduler.Stop()
+
 				// 关闭负载均衡
 				zlog.Info("Stopping Load Balancers")
+				if c.backendScheduler != nil {
+					c.backendScheduler.Stop()
+				}
 				lbManager.StopAll()
 
 				// 关闭RAFT
@@ -326,6 +492,10 @@ func (c *Cluster) ClassifyRaftPeer() error {
 		if err != nil {
 			return err
 		}
+		priority := member.Priority
+		if priority == 0 {
+			priority = DefaultPriority
+		}
 		// 区分LocalPeer和RemotePeers
 		exist, err := network.LocalAddressIsExist(address.IP)
 		if err != nil {
@@ -333,12 +503,19 @@ func (c *Cluster) ClassifyRaftPeer() error {
 		}
 		if exist {
 			// LocalPeer
-			c.LocalPeer = RaftPeer{ID: member.ID, Address: address}
+			c.LocalPeer = RaftPeer{
+				ID:         member.ID,
+				Address:    address,
+				Priority:   priority,
+				APIAddress: member.APIAddress,
+			}
 		} else {
 			// RemotePeers
 			c.RemotePeers = append(c.RemotePeers, RaftPeer{
-				ID:      member.ID,
-				Address: address,
+				ID:         member.ID,
+				Address:    address,
+				Priority:   priority,
+				APIAddress: member.APIAddress,
 			})
 		}
 	}
@@ -350,7 +527,7 @@ func (c *Cluster) PromMemberIsLeader(current float64) {
 		"keep_vip_cluster": setting.Config.Cluster,
 		"server_id":        c.LocalPeer.ID,
 		"server_address":   c.LocalPeer.Address.String(),
-		"vip":              c.Vip.String(),
+		"vip":              c.vipString(),
 	}).Set(current)
 }
 
@@ -359,7 +536,7 @@ func (c *Cluster) PromMemberState(current float64) {
 		"keep_vip_cluster": setting.Config.Cluster,
 		"server_id":        c.LocalPeer.ID,
 		"server_address":   c.LocalPeer.Address.String(),
-		"vip":              c.Vip.String(),
+		"vip":              c.vipString(),
 	}).Set(current)
 }
 
@@ -0,0 +1,57 @@
+package cluster
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"keep-vip/pkg/firewall"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+)
+
+// newFirewall - 根据配置创建nftables规则管理, 未配置规则返回nil
+func newFirewall() (*firewall.Nftables, error) {
+	if len(setting.Config.Firewall.Rules) == 0 {
+		return nil, nil
+	}
+	var rules []firewall.Rule
+	for _, rule := range setting.Config.Firewall.Rules {
+		rules = append(rules, firewall.Rule{
+			Name:  rule.Name,
+			Chain: rule.Chain,
+			Rule:  rule.Rule,
+		})
+	}
+	return firewall.NewNftables(setting.Config.Firewall.Table, rules)
+}
+
+// installFirewall - Leader绑定VIP后安装规则
+func (c *Cluster) installFirewall() {
+	if c.firewall == nil {
+		return
+	}
+	if err := c.firewall.Install(); err != nil {
+		zlog.Error(err)
+		c.PromFirewallInstalled(0)
+		return
+	}
+	c.PromFirewallInstalled(1)
+}
+
+// flushFirewall - 释放VIP后清空规则
+func (c *Cluster) flushFirewall() {
+	if c.firewall == nil {
+		return
+	}
+	if err := c.firewall.Flush(); err != nil {
+		zlog.Error(err)
+	}
+	c.PromFirewallInstalled(0)
+}
+
+func (c *Cluster) PromFirewallInstalled(current float64) {
+	FirewallInstalled.With(prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+		"table":            c.firewall.Status().Table,
+	}).Set(current)
+}
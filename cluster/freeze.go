@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"net/http"
+	"time"
+)
+
+// FreezeRequest - 冻结集群的请求
+type FreezeRequest struct {
+	TTL    string `json:"ttl"`    // 有效时间, 例如1h
+	Reason string `json:"reason"` // 冻结原因, 显示在状态中
+}
+
+// frozen - 集群是否冻结
+func (c *Cluster) frozen() bool {
+	return c.stateMachine.Freeze() != nil
+}
+
+// evaluateFreeze - 在集群循环中定时调用, 冻结期间每次输出警告
+func (c *Cluster) evaluateFreeze() {
+	freeze := c.stateMachine.Freeze()
+	if freeze == nil {
+		if c.wasFrozen {
+			zlog.Warn("Cluster freeze ended")
+			c.wasFrozen = false
+		}
+		return
+	}
+	c.wasFrozen = true
+	zlog.Warn(fmt.Sprintf("Cluster is frozen until %s, checks do not move vips or leadership: %s",
+		freeze.Until.Format(time.RFC3339), freeze.Reason))
+}
+
+// setFreeze - 冻结或解除冻结(freeze为nil). 本节点不是Leader时转发到Leader的成员接口
+func (c *Cluster) setFreeze(freeze *Freeze) error {
+	leaderAddr, leaderID := c.raft.LeaderWithID()
+	if leaderAddr == "" {
+		return errors.New("no leader in the cluster")
+	}
+	if string(leaderID) == c.LocalPeer.ID {
+		return c.apply(command{Op: opSetFreeze, Freeze: freeze})
+	}
+	var leader *RaftPeer
+	for i, peer := range c.RemotePeers {
+		if peer.ID == string(leaderID) {
+			leader = &c.RemotePeers[i]
+		}
+	}
+	if leader == nil || leader.APIAddress == "" {
+		return errors.Errorf("leader %s has no apiAddress, run the command on the leader", leaderID)
+	}
+
+	method, body := http.MethodDelete, []byte(nil)
+	if freeze != nil {
+		data, err := json.Marshal(freeze)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		method, body = http.MethodPut, data
+	}
+	request, err := http.NewRequest(method, fmt.Sprintf("http://%s/v1/peer/freeze", leader.APIAddress), bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if setting.Config.PeerToken != "" {
+		request.Header.Set(peerTokenHeader, setting.Config.PeerToken)
+	}
+	client := &http.Client{Timeout: applyTimeout + peerTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		var result struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&result)
+		return errors.Errorf("leader %s: %s %s", leaderID, response.Status, result.Error)
+	}
+	return nil
+}
+
+// handleFreeze - GET返回集群冻结, PUT冻结集群, DELETE解除冻结.
+// 转发到Leader时本节点的状态机可能还没有应用, PUT和DELETE返回写入的冻结
+func (c *Cluster) handleFreeze(w http.ResponseWriter, r *http.Request) {
+	var freeze *Freeze
+	switch r.Method {
+	case http.MethodGet:
+		freeze = c.stateMachine.Freeze()
+	case http.MethodPut, http.MethodPost:
+		var request FreezeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, errors.WithStack(err))
+			return
+		}
+		ttl, err := time.ParseDuration(request.TTL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.WithStack(err))
+			return
+		}
+		if ttl <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("freeze ttl must be greater than 0"))
+			return
+		}
+		now := time.Now()
+		freeze = &Freeze{Reason: request.Reason, Created: now, Until: now.Add(ttl)}
+		if err := c.setFreeze(freeze); err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+	case http.MethodDelete:
+		if err := c.setFreeze(nil); err != nil {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, freeze)
+}
+
+// handlePeerFreeze - 成员转发的冻结请求, 只在Leader上执行
+func (c *Cluster) handlePeerFreeze(w http.ResponseWriter, r *http.Request) {
+	if err := c.authorizePeer(r); err != nil {
+		zlog.Warn(fmt.Sprintf("Reject peer freeze request from %s: %s", r.RemoteAddr, err))
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	var freeze *Freeze
+	switch r.Method {
+	case http.MethodPut:
+		freeze = &Freeze{}
+		if err := json.NewDecoder(r.Body).Decode(freeze); err != nil {
+			writeError(w, http.StatusBadRequest, errors.WithStack(err))
+			return
+		}
+	case http.MethodDelete:
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if err := c.apply(command{Op: opSetFreeze, Freeze: freeze}); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
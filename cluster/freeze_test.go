@@ -0,0 +1,119 @@
+package cluster
+
+import (
+	"encoding/json"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestRaft - 创建单节点的内存Raft, 等待成为Leader
+func newTestRaft(t *testing.T, id string, fsm *FSM) *raft.Raft {
+	t.Helper()
+	config := raft.DefaultConfig()
+	config.LocalID = raft.ServerID(id)
+	config.HeartbeatTimeout = 50 * time.Millisecond
+	config.ElectionTimeout = 50 * time.Millisecond
+	config.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.CommitTimeout = 5 * time.Millisecond
+	config.Logger = hclog.NewNullLogger()
+	addr, transport := raft.NewInmemTransport("")
+	store := raft.NewInmemStore()
+	r, err := raft.NewRaft(config, fsm, store, store, raft.NewInmemSnapshotStore(), transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Shutdown() })
+	if err := r.BootstrapCluster(raft.Configuration{Servers: []raft.Server{{ID: config.LocalID, Address: addr}}}).Error(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-r.LeaderCh():
+	case <-time.After(5 * time.Second):
+		t.Fatal("raft did not become leader")
+	}
+	return r
+}
+
+// TestHandleFreezeForwarded - 转发到Leader后返回写入的冻结, 不读取还未应用的本地状态机
+func TestHandleFreezeForwarded(t *testing.T) {
+	var forwarded *Freeze
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/peer/freeze" {
+			http.NotFound(w, r)
+			return
+		}
+		forwarded = nil
+		if r.Method == http.MethodPut {
+			forwarded = &Freeze{}
+			if err := json.NewDecoder(r.Body).Decode(forwarded); err != nil {
+				t.Error(err)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer leader.Close()
+
+	c := newTestCluster(t)
+	// Leader的状态机不是本节点的状态机, 本节点还没有应用冻结
+	c.raft = newTestRaft(t, "s2", NewFSM())
+	c.stateMachine = NewFSM()
+	c.RemotePeers = []RaftPeer{{ID: "s2", APIAddress: strings.TrimPrefix(leader.URL, "http://")}}
+
+	w := httptest.NewRecorder()
+	c.handleFreeze(w, httptest.NewRequest(http.MethodPut, "/v1/freeze", strings.NewReader(`{"ttl":"1h","reason":"upgrade"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, body %s", w.Code, w.Body)
+	}
+	var freeze *Freeze
+	if err := json.NewDecoder(w.Body).Decode(&freeze); err != nil {
+		t.Fatal(err)
+	}
+	if freeze == nil || freeze.Reason != "upgrade" || time.Until(freeze.Until) < 59*time.Minute {
+		t.Fatalf("PUT returned %+v, want the freeze sent to the leader", freeze)
+	}
+	if forwarded == nil || !forwarded.Until.Equal(freeze.Until) {
+		t.Fatalf("leader received %+v, want %+v", forwarded, freeze)
+	}
+
+	w = httptest.NewRecorder()
+	c.handleFreeze(w, httptest.NewRequest(http.MethodDelete, "/v1/freeze", nil))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "null" {
+		t.Fatalf("DELETE = %d %s, want 200 null", w.Code, w.Body)
+	}
+	if forwarded != nil {
+		t.Fatalf("leader received %+v for DELETE, want unfreeze", forwarded)
+	}
+}
+
+func TestHandleFreezeLeader(t *testing.T) {
+	c := newTestCluster(t)
+	c.LocalPeer.ID = "s1"
+	c.stateMachine = NewFSM()
+	c.raft = newTestRaft(t, "s1", c.stateMachine)
+	w := httptest.NewRecorder()
+	c.handleFreeze(w, httptest.NewRequest(http.MethodPut, "/v1/freeze", strings.NewReader(`{"ttl":"30m","reason":"incident"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"reason":"incident"`) {
+		t.Fatalf("PUT = %d %s", w.Code, w.Body)
+	}
+	// Leader上写入后状态机已经应用
+	w = httptest.NewRecorder()
+	c.handleFreeze(w, httptest.NewRequest(http.MethodGet, "/v1/freeze", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"reason":"incident"`) || !c.frozen() {
+		t.Fatalf("GET = %d %s, want the applied freeze", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	c.handleFreeze(w, httptest.NewRequest(http.MethodDelete, "/v1/freeze", nil))
+	if w.Code != http.StatusOK || c.frozen() {
+		t.Fatalf("DELETE = %d %s, cluster still frozen", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	c.handleFreeze(w, httptest.NewRequest(http.MethodPut, "/v1/freeze", strings.NewReader(`{"ttl":"0s"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("PUT with zero ttl = %d, want 400", w.Code)
+	}
+}
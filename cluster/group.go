@@ -0,0 +1,210 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"keep-vip/pkg/network"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"strings"
+)
+
+// DefaultGroup - 顶层vip配置对应的同步组名称
+const DefaultGroup = "default"
+
+// newVipGroups - 根据配置创建VIP同步组, 顶层vip作为default组
+func newVipGroups() ([]*network.VipGroup, error) {
+	checks := make(map[string]bool)
+	for _, check := range setting.Config.Checks {
+		checks[check.Name] = true
+	}
+	for _, group := range setting.Config.CheckGroups {
+		checks[group.Name] = true
+	}
+
+	var groups []*network.VipGroup
+	if setting.Config.VIP != "" {
+		vip, err := newVip(setting.Config.VIP, setting.Config.Interface, setting.Config.Netns,
+			setting.Config.Mode, setting.Config.Route.Table, setting.Config.Route.RulePriority)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, &network.VipGroup{Name: DefaultGroup, Vips: []network.Vip{vip}})
+	}
+	for _, confGroup := range setting.Config.SyncGroups {
+		if confGroup.Name == "" {
+			return nil, errors.New("sync group name cannot be blank")
+		}
+		if len(confGroup.Vips) == 0 {
+			return nil, errors.Errorf("sync group %s has no vips", confGroup.Name)
+		}
+		for _, name := range confGroup.Checks {
+			if !checks[name] {
+				return nil, errors.Errorf("sync group %s tracks unknown check: %s", confGroup.Name, name)
+			}
+		}
+		group := &network.VipGroup{Name: confGroup.Name, Checks: confGroup.Checks}
+		for _, confVip := range confGroup.Vips {
+			iface, netns, mode, route := confVip.Interface, confVip.Netns, confVip.Mode, confVip.Route
+			if iface == "" {
+				iface = setting.Config.Interface
+			}
+			if netns == "" {
+				netns = setting.Config.Netns
+			}
+			if mode == "" {
+				mode = setting.Config.Mode
+			}
+			if route.Table == 0 && route.RulePriority == 0 {
+				route = setting.Config.Route
+			}
+			vip, err := newVip(confVip.Address, iface, netns, mode, route.Table, route.RulePriority)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "sync group %s", confGroup.Name)
+			}
+			group.Vips = append(group.Vips, vip)
+		}
+		groups = append(groups, group)
+	}
+
+	// 同步组名称和VIP地址不能重复
+	names := make(map[string]bool)
+	addresses := make(map[string]string)
+	for _, group := range groups {
+		if names[group.Name] {
+			return nil, errors.Errorf("duplicate sync group name: %s", group.Name)
+		}
+		names[group.Name] = true
+		for _, vip := range group.Vips {
+			if owner, ok := addresses[vip.String()]; ok {
+				return nil, errors.Errorf("vip %s is configured in both sync group %s and %s", vip.String(), owner, group.Name)
+			}
+			addresses[vip.String()] = group.Name
+		}
+	}
+	return groups, nil
+}
+
+// newVip - 根据模式创建VIP
+func newVip(address, iface, netns, mode string, table, rulePriority int) (network.Vip, error) {
+	switch strings.ToLower(mode) {
+	case "", network.ModeAddress:
+		return network.NewVip(address, iface, netns)
+	case network.ModeRoute:
+		return network.NewVipRoute(address, iface, netns, table, rulePriority)
+	default:
+		return nil, errors.Errorf("vip %s the mode is not supported: %s", address, mode)
+	}
+}
+
+// cleanStaleVips - 删除所有网络命名空间中带有keep-vip标签的VIP和nftables规则
+func (c *Cluster) cleanStaleVips() error {
+	namespaces := []string{""}
+	seen := map[string]bool{"": true}
+	var vips []network.Vip
+	for _, group := range c.VipGroups {
+		for _, vip := range group.Vips {
+			vips = append(vips, vip)
+			if !seen[vip.Netns()] {
+				seen[vip.Netns()] = true
+				namespaces = append(namespaces, vip.Netns())
+			}
+		}
+	}
+	for _, netns := range namespaces {
+		removed, err := network.CleanStaleVips(netns, vips)
+		for _, stale := range removed {
+			zlog.Warn("Removed stale vip left by previous run: " + stale)
+		}
+		StaleVipsRemoved.With(prometheus.Labels{
+			"keep_vip_cluster": setting.Config.Cluster,
+			"server_id":        c.LocalPeer.ID,
+			"server_address":   c.LocalPeer.Address.String(),
+		}).Add(float64(len(removed)))
+		if err != nil {
+			return errors.WithMessage(err, "clean stale vips failed")
+		}
+	}
+	c.flushFirewall()
+	return nil
+}
+
+// acquireVips - 绑定所有同步组的VIP并广播ARP, 网络接口DOWN则整体迁移
+func (c *Cluster) acquireVips() {
+	// 维护中的节点不绑定VIP
+	if c.maintenance() {
+		c.releaseVips()
+		return
+	}
+	for _, group := range c.VipGroups {
+		if err := group.CheckLinks(); err != nil {
+			// 集群冻结期间保持VIP
+			if c.frozen() {
+				zlog.Warn(fmt.Sprintf("Sync group [%s] failed, cluster is frozen, keep vips: %s", group.Name, err))
+				continue
+			}
+			// 放置模式不转移Leader, 释放VIP等待Leader重新分配
+			if c.placement() {
+				zlog.Warn(fmt.Sprintf("Sync group [%s] failed, releasing vips: %s", group.Name, err))
+				c.releaseVips()
+				return
+			}
+			if c.failover(group, err) {
+				return
+			}
+		}
+	}
+	for _, group := range c.VipGroups {
+		if err := group.AddVIP(); err != nil {
+			zlog.Warn(err.Error())
+			continue
+		}
+		if err := group.SendGratuitous(); err != nil {
+			zlog.Warn(err.Error())
+		}
+	}
+	c.installFirewall()
+	c.PromMemberIsLeader(1)
+}
+
+// releaseVips - 清空nftables规则, 释放所有同步组的VIP
+func (c *Cluster) releaseVips() {
+	c.flushFirewall()
+	for _, group := range c.VipGroups {
+		if err := group.DeleteVIP(); err != nil {
+			zlog.Warn(err.Error())
+		}
+	}
+	c.PromMemberIsLeader(0)
+}
+
+// failover - 同步组跟踪的网络接口或检查失败, 释放VIP并转移Leader到健康的成员. 返回true表示已经放弃Leader
+func (c *Cluster) failover(group *network.VipGroup, reason error) bool {
+	zlog.Warn(fmt.Sprintf("Sync group [%s] failed, releasing vips and transferring leadership: %s", group.Name, reason))
+	return c.handoff(reason, func() {
+		c.releaseVips()
+		transfer(c.raft.LeadershipTransfer())
+	})
+}
+
+// trackedGroup - 返回跟踪该检查的同步组
+func (c *Cluster) trackedGroup(check string) *network.VipGroup {
+	for _, group := range c.VipGroups {
+		if group.Tracks(check) {
+			return group
+		}
+	}
+	return nil
+}
+
+// vipString - 返回所有VIP地址, 用于日志和监控标签
+func (c *Cluster) vipString() string {
+	var vips []string
+	for _, group := range c.VipGroups {
+		for _, vip := range group.Vips {
+			vips = append(vips, vip.String())
+		}
+	}
+	return strings.Join(vips, ",")
+}
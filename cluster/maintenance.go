@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// drainState - 通过管理接口设置的排空状态
+type drainState struct {
+	mu      sync.RWMutex
+	enabled bool
+	reason  string
+	since   time.Time
+	changes chan struct{}
+}
+
+// MaintenanceStatus - 维护状态
+type MaintenanceStatus struct {
+	File   string     `json:"file,omitempty"` // 存在的维护文件
+	Drain  bool       `json:"drain"`
+	Reason string     `json:"reason,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// DrainRequest - 设置排空的请求
+type DrainRequest struct {
+	Reason string `json:"reason"`
+}
+
+// maintenanceFile - 存在时返回维护文件路径
+func maintenanceFile() string {
+	if setting.Config.MaintenanceFile == "" {
+		return ""
+	}
+	if _, err := os.Stat(setting.Config.MaintenanceFile); err != nil {
+		return ""
+	}
+	return setting.Config.MaintenanceFile
+}
+
+// maintenance - 维护文件存在或者设置了排空时返回true. 维护中的节点释放VIP, 不能成为Leader, 负载均衡不接受新连接
+func (c *Cluster) maintenance() bool {
+	c.drain.mu.RLock()
+	enabled := c.drain.enabled
+	c.drain.mu.RUnlock()
+	return enabled || maintenanceFile() != ""
+}
+
+// maintenanceStatus - 返回维护状态, 不在维护中返回nil
+func (c *Cluster) maintenanceStatus() *MaintenanceStatus {
+	c.drain.mu.RLock()
+	defer c.drain.mu.RUnlock()
+	file := maintenanceFile()
+	if !c.drain.enabled && file == "" {
+		return nil
+	}
+	status := &MaintenanceStatus{File: file, Drain: c.drain.enabled, Reason: c.drain.reason}
+	if c.drain.enabled {
+		since := c.drain.since
+		status.Since = &since
+	}
+	return status
+}
+
+// setDrain - 设置或清除排空, 通知集群循环立即处理
+func (c *Cluster) setDrain(enabled bool, reason string) {
+	c.drain.mu.Lock()
+	if enabled != c.drain.enabled {
+		c.drain.since = time.Now()
+	}
+	c.drain.enabled = enabled
+	c.drain.reason = reason
+	c.drain.mu.Unlock()
+	select {
+	case c.drain.changes <- struct{}{}:
+	default:
+	}
+}
+
+// evaluateMaintenance - 在集群循环中调用. 维护状态变化时记录日志, 排空负载均衡; 维护中的Leader释放VIP并转移Leader.
+// 返回true表示已经放弃Leader
+func (c *Cluster) evaluateMaintenance(isLeader bool) bool {
+	maintenance := c.maintenance()
+	if maintenance != c.inMaintenance {
+		c.inMaintenance = maintenance
+		if maintenance {
+			zlog.Warn("Entering maintenance, releasing vips and draining load balancers")
+		} else {
+			zlog.Warn("Leaving maintenance, back in service")
+		}
+		c.lbManager.DrainAll(maintenance)
+		if maintenance {
+			c.PromMemberMaintenance(1)
+		} else {
+			c.PromMemberMaintenance(0)
+		}
+	}
+	if !maintenance {
+		return false
+	}
+	c.releaseVips()
+	if !isLeader || c.exiting || len(c.RemotePeers) == 0 {
+		return false
+	}
+	// 优先转移给健康的成员, 没有健康的成员时由Raft选择
+	if successor := c.successor(c.collectHealth()); successor != nil {
+		zlog.Warn(fmt.Sprintf("Node in maintenance, transfer leadership to %s", successor.ID))
+		c.transferTo(successor)
+		return true
+	}
+	zlog.Warn("Node in maintenance, transfer leadership")
+	transfer(c.raft.LeadershipTransfer())
+	return true
+}
+
+// handleDrain - GET返回维护状态, PUT开始排空, DELETE结束排空
+func (c *Cluster) handleDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var request DrainRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				writeError(w, http.StatusBadRequest, errors.WithStack(err))
+				return
+			}
+		}
+		c.setDrain(true, request.Reason)
+	case http.MethodDelete:
+		c.setDrain(false, "")
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	status := c.maintenanceStatus()
+	if status == nil {
+		status = &MaintenanceStatus{}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (c *Cluster) PromMemberMaintenance(current float64) {
+	MemberMaintenance.With(prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+	}).Set(current)
+}
@@ -0,0 +1,121 @@
+package cluster
+
+import (
+	"keep-vip/pkg/loadbalancer"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceFileAndDrain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "maintenance")
+	loadConfig(t, "maintenanceFile: "+file)
+	c := newTestCluster(t)
+	c.drain.changes = make(chan struct{}, 1)
+	if c.maintenance() || c.maintenanceStatus() != nil {
+		t.Fatal("in maintenance without file or drain")
+	}
+
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if status := c.maintenanceStatus(); !c.maintenance() || status == nil || status.File != file || status.Drain {
+		t.Fatalf("maintenance status with file = %+v", status)
+	}
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if c.maintenance() {
+		t.Fatal("still in maintenance after removing the file")
+	}
+
+	c.setDrain(true, "upgrade")
+	select {
+	case <-c.drain.changes:
+	default:
+		t.Fatal("setDrain did not notify the cluster loop")
+	}
+	status := c.maintenanceStatus()
+	if !c.maintenance() || status == nil || !status.Drain || status.Reason != "upgrade" || status.Since == nil {
+		t.Fatalf("maintenance status with drain = %+v", status)
+	}
+	since := *status.Since
+	// 重复设置不改变开始时间
+	c.setDrain(true, "still upgrading")
+	if status := c.maintenanceStatus(); !status.Since.Equal(since) || status.Reason != "still upgrading" {
+		t.Fatalf("maintenance status after repeated drain = %+v", status)
+	}
+	c.setDrain(false, "")
+	if c.maintenance() || c.maintenanceStatus() != nil {
+		t.Fatal("still in maintenance after clearing drain")
+	}
+}
+
+func TestEvaluateMaintenance(t *testing.T) {
+	loadConfig(t, "cluster: test")
+	c := newTestCluster(t)
+	c.drain.changes = make(chan struct{}, 1)
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bind := free.Addr().(*net.TCPAddr)
+	free.Close()
+	manager := loadbalancer.NewLBManager()
+	if err := manager.AddLoadBalancer(&loadbalancer.LoadBalancer{Name: "web", Type: "tcp", BindAddress: bind}); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.StopAll()
+	c.lbManager = &manager
+	listening := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			conn, err := net.DialTimeout("tcp", bind.String(), 100*time.Millisecond)
+			if conn != nil {
+				conn.Close()
+			}
+			if (err == nil) == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("load balancer listening = %v, want %v", err == nil, want)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	if c.evaluateMaintenance(true) || c.inMaintenance {
+		t.Fatal("evaluateMaintenance gave up leadership without maintenance")
+	}
+	listening(true)
+
+	// 单节点集群没有可以转移的成员, 保持Leader(raft为nil, 调用转移会panic)
+	c.setDrain(true, "upgrade")
+	if c.evaluateMaintenance(true) {
+		t.Fatal("single node gave up leadership in maintenance")
+	}
+	if !c.inMaintenance {
+		t.Fatal("maintenance was not recorded")
+	}
+	listening(false)
+	if c.evaluateMaintenance(false) {
+		t.Fatal("follower reported giving up leadership")
+	}
+
+	// 退出中不转移Leader
+	c.RemotePeers = []RaftPeer{{ID: "s2"}}
+	c.exiting = true
+	if c.evaluateMaintenance(true) {
+		t.Fatal("exiting node transferred leadership")
+	}
+	c.exiting = false
+
+	c.setDrain(false, "")
+	if c.evaluateMaintenance(true) || c.inMaintenance {
+		t.Fatal("still in maintenance after clearing drain")
+	}
+	listening(true)
+}
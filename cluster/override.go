@@ -0,0 +1,115 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"keep-vip/pkg/health"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OverrideRequest - 设置检查覆盖的请求
+type OverrideRequest struct {
+	Mode   string `json:"mode"`   // pause|pass|fail
+	TTL    string `json:"ttl"`    // 有效时间, 例如30m
+	Reason string `json:"reason"` // 覆盖原因, 显示在状态中
+}
+
+// evaluateOverrides - 在集群循环中调用, 记录覆盖开始和结束的日志, 更新监控
+func (c *Cluster) evaluateOverrides() {
+	current := make(map[string]health.Override)
+	for _, override := range c.scheduler.Store().Overrides() {
+		current[override.Name] = override
+	}
+	for name, last := range c.overrides {
+		if override, ok := current[name]; ok && override == last {
+			continue
+		}
+		zlog.Warn(fmt.Sprintf("Override %s of check %s ended", last.Mode, name))
+		c.PromCheckOverride(last, false)
+	}
+	for name, override := range current {
+		if last, ok := c.overrides[name]; ok && override == last {
+			continue
+		}
+		zlog.Warn(fmt.Sprintf("Check %s overridden to %s until %s: %s",
+			name, override.Mode, override.Expires.Format(time.RFC3339), override.Reason))
+		c.PromCheckOverride(override, true)
+	}
+	c.overrides = current
+}
+
+// handleOverrides - GET /v1/overrides 返回所有未过期的覆盖
+func (c *Cluster) handleOverrides(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, c.scheduler.Store().Overrides())
+}
+
+// handleCheckOverride - PUT|DELETE /v1/checks/{name}/override 设置或删除检查的覆盖
+func (c *Cluster) handleCheckOverride(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/checks/"), "/override")
+	if name == "" || strings.Contains(name, "/") || !strings.HasSuffix(r.URL.Path, "/override") {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if c.check(name) == nil {
+		writeError(w, http.StatusNotFound, errors.Errorf("unknown check: %s", name))
+		return
+	}
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		var request OverrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, errors.WithStack(err))
+			return
+		}
+		ttl, err := time.ParseDuration(request.TTL)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.WithStack(err))
+			return
+		}
+		override, err := health.NewOverride(name, request.Mode, ttl, request.Reason)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := c.scheduler.SetOverride(override); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, override)
+	case http.MethodDelete:
+		if !c.scheduler.ClearOverride(name) {
+			writeError(w, http.StatusNotFound, errors.Errorf("check %s has no override", name))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (c *Cluster) PromCheckOverride(override health.Override, active bool) {
+	check := c.check(override.Name)
+	labels := prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+		"name":             override.Name,
+		"address":          check.Address,
+		"mode":             override.Mode,
+	}
+	if !active {
+		CheckOverride.Delete(labels)
+		return
+	}
+	CheckOverride.With(labels).Set(float64(override.Expires.Unix()))
+}
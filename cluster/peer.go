@@ -0,0 +1,435 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"keep-vip/pkg/health"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultPriority    = 100                    // 成员默认优先级
+	DefaultScoreMargin = 1                      // 成员分数默认至少高出1才转移Leader
+	peerTimeout        = 500 * time.Millisecond // 获取成员分数的超时时间
+	applyTimeout       = 500 * time.Millisecond // 等待写入Raft日志的超时时间, 小于集群循环的周期
+	peerTokenHeader    = "X-Keep-Vip-Token"     // 成员接口写操作携带共享密钥的请求头
+)
+
+// score - 本节点分数: 优先级加上加权检查的权重. 加权检查passing时加正权重, failing时加负权重
+func (c *Cluster) score() int {
+	score := c.LocalPeer.Priority
+	store := c.scheduler.Store()
+	for _, check := range c.checks {
+		switch state := store.State(check.Name); {
+		case check.Weight > 0 && state == health.StatePassing:
+			score += check.Weight
+		case check.Weight < 0 && state == health.StateFailing:
+			score += check.Weight
+		}
+	}
+	return score
+}
+
+// healthy - 本节点是否健康: 不在维护中, 同步组的网络接口都是UP, 决定节点健康的检查和检查组中没有failing的非加权检查.
+// 放置检查不包含在决定节点健康的检查中
+func (c *Cluster) healthy() bool {
+	if c.maintenance() {
+		return false
+	}
+	for _, group := range c.VipGroups {
+		if err := group.CheckLinks(); err != nil {
+			return false
+		}
+	}
+	for _, name := range c.decisions() {
+		if !c.weighted(name) && c.state(name) == health.StateFailing {
+			return false
+		}
+	}
+	return true
+}
+
+// localHealth - 本节点健康状态
+func (c *Cluster) localHealth() MemberHealth {
+	checks := make(map[string]string, len(c.checks)+len(c.checkGroups))
+	for _, check := range c.checks {
+		checks[check.Name] = c.state(check.Name).String()
+	}
+	for _, group := range c.checkGroups {
+		checks[group.Name] = c.state(group.Name).String()
+	}
+	return MemberHealth{
+		ID:          c.LocalPeer.ID,
+		Priority:    c.LocalPeer.Priority,
+		Score:       c.score(),
+		Healthy:     c.healthy(),
+		Checks:      checks,
+		Holding:     c.bound(),
+		Maintenance: c.maintenance(),
+		Updated:     time.Now(),
+	}
+}
+
+// startPeer - 启动成员接口, 提供本节点分数给Leader
+func (c *Cluster) startPeer() error {
+	if c.LocalPeer.APIAddress == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", c.LocalPeer.APIAddress)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/peer/health", c.handlePeerHealth)
+	mux.HandleFunc("/v1/peer/freeze", c.handlePeerFreeze)
+	c.peer = &http.Server{Handler: mux}
+	go func() {
+		zlog.Info(fmt.Sprintf("Enabled peer api at: http://%s", listener.Addr().String()))
+		if err := c.peer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			zlog.Error(errors.WithStack(err))
+		}
+	}()
+	return nil
+}
+
+// stopPeer - 关闭成员接口
+func (c *Cluster) stopPeer() {
+	if c.peer == nil {
+		return
+	}
+	if err := c.peer.Close(); err != nil {
+		zlog.Warn(err.Error())
+	}
+}
+
+// authorizePeer - 成员接口写操作的认证: 配置了peerToken时校验共享密钥, 否则只接受集群成员IP的请求
+func (c *Cluster) authorizePeer(r *http.Request) error {
+	if setting.Config.PeerToken != "" {
+		token := r.Header.Get(peerTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(setting.Config.PeerToken)) != 1 {
+			return errors.New("invalid peer token")
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	source := net.ParseIP(host)
+	for _, peer := range c.RemotePeers {
+		if peer.Address.IP.Equal(source) {
+			return nil
+		}
+		if apiHost, _, err := net.SplitHostPort(peer.APIAddress); err == nil && net.ParseIP(apiHost).Equal(source) {
+			return nil
+		}
+	}
+	return errors.Errorf("%s is not a cluster member", host)
+}
+
+func (c *Cluster) handlePeerHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, c.localHealth())
+}
+
+// peerCache - 后台定时获取的其他成员健康状态, 集群循环只读取缓存, 不会被成员接口阻塞
+type peerCache struct {
+	mu      sync.Mutex
+	members map[string]MemberHealth
+	fetched map[string]time.Time // 成员最近一次获取成功的本地时间
+	stop    chan struct{}
+}
+
+// peerAPIs - 是否有其他成员配置了成员接口
+func (c *Cluster) peerAPIs() bool {
+	for _, peer := range c.RemotePeers {
+		if peer.APIAddress != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// peerStale - 超过该时间没有获取成功的成员不再使用
+func peerStale() time.Duration {
+	return 3*time.Second*time.Duration(setting.Config.ChecksInterval) + peerTimeout
+}
+
+// startCollector - 每个检查周期在后台获取一次其他成员的健康状态
+func (c *Cluster) startCollector() {
+	if !c.peerAPIs() {
+		return
+	}
+	c.peers.members = make(map[string]MemberHealth)
+	c.peers.fetched = make(map[string]time.Time)
+	c.peers.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second * time.Duration(setting.Config.ChecksInterval))
+		defer ticker.Stop()
+		for {
+			c.fetchPeers()
+			select {
+			case <-c.peers.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopCollector - 停止获取成员健康状态
+func (c *Cluster) stopCollector() {
+	if c.peers.stop != nil {
+		close(c.peers.stop)
+	}
+}
+
+// fetchPeers - 并发获取其他成员的健康状态写入缓存, 获取失败的成员保留上次的结果直到过期
+func (c *Cluster) fetchPeers() {
+	client := &http.Client{Timeout: peerTimeout}
+	var wg sync.WaitGroup
+	for _, peer := range c.RemotePeers {
+		if peer.APIAddress == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(peer RaftPeer) {
+			defer wg.Done()
+			member, err := fetchHealth(client, peer.APIAddress)
+			if err != nil {
+				zlog.Debug(fmt.Sprintf("Get health of member %s failed: %s", peer.ID, err))
+				return
+			}
+			if member.ID != peer.ID {
+				zlog.Warn(fmt.Sprintf("Member %s api %s reported id %s", peer.ID, peer.APIAddress, member.ID))
+				return
+			}
+			c.peers.mu.Lock()
+			c.peers.members[peer.ID] = member
+			c.peers.fetched[peer.ID] = time.Now()
+			c.peers.mu.Unlock()
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// collectHealth - 本节点和缓存中未过期的其他成员的健康状态
+func (c *Cluster) collectHealth() map[string]MemberHealth {
+	members := map[string]MemberHealth{c.LocalPeer.ID: c.localHealth()}
+	c.peers.mu.Lock()
+	defer c.peers.mu.Unlock()
+	for id, member := range c.peers.members {
+		if time.Since(c.peers.fetched[id]) <= peerStale() {
+			members[id] = member
+		}
+	}
+	return members
+}
+
+// fetchHealth - 获取成员健康状态
+func fetchHealth(client *http.Client, address string) (MemberHealth, error) {
+	var member MemberHealth
+	resp, err := client.Get(fmt.Sprintf("http://%s/v1/peer/health", address))
+	if err != nil {
+		return member, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return member, errors.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&member); err != nil {
+		return member, errors.WithStack(err)
+	}
+	return member, nil
+}
+
+// evaluateScores - 在集群循环中调用. Leader收集成员分数写入状态机, 有分数更高的健康成员时转移Leader
+func (c *Cluster) evaluateScores(isLeader bool) {
+	c.PromMemberScore(float64(c.score()))
+	// 放置模式VIP不绑定到Leader, 不需要根据分数转移Leader
+	if !isLeader || c.exiting || c.placement() || c.frozen() {
+		return
+	}
+	members := c.collectHealth()
+	if err := c.applyHealth(members); err != nil {
+		zlog.Error(errors.WithMessage(err, "apply member health"))
+	}
+
+	// 分数至少高出scoreMargin并且持续scoreHold才转移, 避免加权检查抖动导致反复转移Leader
+	local := members[c.LocalPeer.ID]
+	successor := c.successor(members)
+	if successor == nil || members[successor.ID].Score < local.Score+scoreMargin() {
+		c.outscoredBy = ""
+		return
+	}
+	if c.outscoredBy != successor.ID {
+		c.outscoredBy = successor.ID
+		c.outscoredSince = time.Now()
+		zlog.Info(fmt.Sprintf("Member %s score %d is higher than local score %d, transfer leadership after %s",
+			successor.ID, members[successor.ID].Score, local.Score, scoreHold()))
+	}
+	if time.Since(c.outscoredSince) < scoreHold() {
+		return
+	}
+	c.outscoredBy = ""
+	zlog.Warn(fmt.Sprintf("Member %s score %d is higher than local score %d, transfer leadership",
+		successor.ID, members[successor.ID].Score, local.Score))
+	c.transferTo(successor)
+}
+
+// scoreMargin - 成员分数至少高出多少才转移Leader
+func scoreMargin() int {
+	if setting.Config.ScoreMargin <= 0 {
+		return DefaultScoreMargin
+	}
+	return setting.Config.ScoreMargin
+}
+
+// scoreHold - 成员分数持续高出多久才转移Leader, 默认3个检查周期
+func scoreHold() time.Duration {
+	if setting.Config.ScoreHold <= 0 {
+		return 3 * time.Second * time.Duration(setting.Config.ChecksInterval)
+	}
+	return time.Second * time.Duration(setting.Config.ScoreHold)
+}
+
+// successor - 返回分数最高的健康成员, 分数相同时按配置顺序
+func (c *Cluster) successor(members map[string]MemberHealth) *RaftPeer {
+	var best *RaftPeer
+	for i, peer := range c.RemotePeers {
+		member, ok := members[peer.ID]
+		if !ok || !member.Healthy {
+			continue
+		}
+		if best == nil || member.Score > members[best.ID].Score {
+			best = &c.RemotePeers[i]
+		}
+	}
+	return best
+}
+
+// handoff - Leader检查失败, 把Leader转移给健康的成员. 返回true表示已经放弃Leader
+// 没有成员配置成员接口时执行fallback; 成员接口都无法访问(网络分区)或者所有成员都不健康时继续保持Leader, 避免依次退出
+func (c *Cluster) handoff(reason error, fallback func()) bool {
+	if !c.peerAPIs() {
+		fallback()
+		return true
+	}
+	members := c.collectHealth()
+	if err := c.applyHealth(members); err != nil {
+		zlog.Error(errors.WithMessage(err, "apply member health"))
+	}
+	if len(members) == 1 {
+		zlog.Error(errors.Errorf("No member reported health, keep leadership: %s", reason))
+		return false
+	}
+	successor := c.successor(members)
+	if successor == nil {
+		zlog.Warn(fmt.Sprintf("No healthy member to take over, keep leadership: %s", reason))
+		return false
+	}
+	zlog.Warn(fmt.Sprintf("Transfer leadership to healthy member %s: %s", successor.ID, reason))
+	c.transferTo(successor)
+	return true
+}
+
+// transferTo - 释放VIP并转移Leader到指定成员
+func (c *Cluster) transferTo(peer *RaftPeer) {
+	c.releaseVips()
+	transfer(c.raft.LeadershipTransferToServer(raft.ServerID(peer.ID), raft.ServerAddress(peer.Address.String())))
+}
+
+// transfer - 在后台等待Leader转移的结果, 转移较慢时不阻塞集群循环维护VIP和ARP
+func transfer(future raft.Future) {
+	go func() {
+		switch err := future.Error(); err {
+		case nil, raft.ErrNotLeader:
+		case raft.ErrLeadershipTransferInProgress:
+			// 上一次转移还未结束
+			zlog.Debug(err.Error())
+		default:
+			zlog.Error(errors.WithStack(err))
+		}
+	}()
+}
+
+// waitFuture - 最多等待timeout, 超时后Raft操作在后台继续执行
+func waitFuture(future raft.Future, timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- future.Error()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return errors.Errorf("raft operation not finished after %s", timeout)
+	}
+}
+
+// applyHealth - 成员分数变化时写入状态机, 复制到所有成员
+func (c *Cluster) applyHealth(members map[string]MemberHealth) error {
+	if !healthChanged(c.stateMachine.Members(), members) {
+		return nil
+	}
+	return c.apply(command{Op: opSetHealth, Members: members})
+}
+
+// apply - 写入命令到Raft日志, 只能在Leader上调用. 最多等待applyTimeout, 不阻塞集群循环
+func (c *Cluster) apply(cmd command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	future := c.raft.Apply(data, applyTimeout)
+	if err := waitFuture(future, applyTimeout); err != nil {
+		return errors.WithStack(err)
+	}
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// healthChanged - 比较成员的分数和检查状态, 忽略更新时间
+func healthChanged(old, current map[string]MemberHealth) bool {
+	if len(old) != len(current) {
+		return true
+	}
+	for id, member := range current {
+		o, ok := old[id]
+		if !ok || o.Priority != member.Priority || o.Score != member.Score || o.Healthy != member.Healthy ||
+			o.Holding != member.Holding || o.Maintenance != member.Maintenance {
+			return true
+		}
+		if len(o.Checks) != len(member.Checks) {
+			return true
+		}
+		for name, state := range member.Checks {
+			if o.Checks[name] != state {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Cluster) PromMemberScore(current float64) {
+	MemberScore.With(prometheus.Labels{
+		"keep_vip_cluster": setting.Config.Cluster,
+		"server_id":        c.LocalPeer.ID,
+		"server_address":   c.LocalPeer.Address.String(),
+	}).Set(current)
+}
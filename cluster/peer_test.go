@@ -0,0 +1,239 @@
+package cluster
+
+import (
+	"github.com/hashicorp/raft"
+	"keep-vip/pkg/health"
+	"keep-vip/setting"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthChanged(t *testing.T) {
+	base := func() map[string]MemberHealth {
+		return map[string]MemberHealth{
+			"s1": {ID: "s1", Priority: 100, Score: 110, Healthy: true, Checks: map[string]string{"web": "passing"}, Updated: time.Unix(1, 0)},
+			"s2": {ID: "s2", Priority: 90, Score: 90, Healthy: true, Checks: map[string]string{"web": "passing"}, Updated: time.Unix(1, 0)},
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(members map[string]MemberHealth)
+		want   bool
+	}{
+		{name: "unchanged", modify: func(map[string]MemberHealth) {}, want: false},
+		{name: "updated time ignored", modify: func(m map[string]MemberHealth) {
+			s1 := m["s1"]
+			s1.Updated = time.Unix(2, 0)
+			m["s1"] = s1
+		}, want: false},
+		{name: "score", modify: func(m map[string]MemberHealth) {
+			s1 := m["s1"]
+			s1.Score = 100
+			m["s1"] = s1
+		}, want: true},
+		{name: "healthy", modify: func(m map[string]MemberHealth) {
+			s2 := m["s2"]
+			s2.Healthy = false
+			m["s2"] = s2
+		}, want: true},
+		{name: "holding", modify: func(m map[string]MemberHealth) {
+			s2 := m["s2"]
+			s2.Holding = true
+			m["s2"] = s2
+		}, want: true},
+		{name: "maintenance", modify: func(m map[string]MemberHealth) {
+			s2 := m["s2"]
+			s2.Maintenance = true
+			m["s2"] = s2
+		}, want: true},
+		{name: "check state", modify: func(m map[string]MemberHealth) {
+			m["s1"].Checks["web"] = "failing"
+		}, want: true},
+		{name: "check added", modify: func(m map[string]MemberHealth) {
+			m["s1"].Checks["db"] = "passing"
+		}, want: true},
+		{name: "member removed", modify: func(m map[string]MemberHealth) {
+			delete(m, "s2")
+		}, want: true},
+		{name: "member replaced", modify: func(m map[string]MemberHealth) {
+			delete(m, "s2")
+			m["s3"] = MemberHealth{ID: "s3"}
+		}, want: true},
+	}
+	for _, tt := range tests {
+		current := base()
+		tt.modify(current)
+		if got := healthChanged(base(), current); got != tt.want {
+			t.Errorf("%s: healthChanged = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorizePeer(t *testing.T) {
+	c := &Cluster{RemotePeers: []RaftPeer{
+		{ID: "s2", Address: &net.TCPAddr{IP: net.ParseIP("172.16.0.12"), Port: 20000}, APIAddress: "172.16.0.22:20001"},
+	}}
+	request := func(remote, token string) *http.Request {
+		r := httptest.NewRequest(http.MethodPut, "/v1/peer/freeze", nil)
+		r.RemoteAddr = remote
+		if token != "" {
+			r.Header.Set(peerTokenHeader, token)
+		}
+		return r
+	}
+	defer func(token string) { setting.Config.PeerToken = token }(setting.Config.PeerToken)
+
+	setting.Config.PeerToken = ""
+	for remote, want := range map[string]bool{
+		"172.16.0.12:40000": true,
+		"172.16.0.22:40000": true,
+		"172.16.0.99:40000": false,
+	} {
+		if err := c.authorizePeer(request(remote, "")); (err == nil) != want {
+			t.Errorf("member ip %s: authorized = %v, want %v", remote, err == nil, want)
+		}
+	}
+
+	setting.Config.PeerToken = "secret"
+	tests := []struct {
+		remote, token string
+		want          bool
+	}{
+		{remote: "172.16.0.99:40000", token: "secret", want: true},
+		{remote: "172.16.0.12:40000", token: "", want: false},
+		{remote: "172.16.0.12:40000", token: "wrong", want: false},
+	}
+	for _, tt := range tests {
+		if err := c.authorizePeer(request(tt.remote, tt.token)); (err == nil) != tt.want {
+			t.Errorf("token %q from %s: authorized = %v, want %v", tt.token, tt.remote, err == nil, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	checks := []setting.Check{
+		{Name: "web", Weight: 10},
+		{Name: "db", Weight: -20},
+		{Name: "disk"},
+	}
+	tests := []struct {
+		name   string
+		states map[string]health.State
+		want   int
+	}{
+		{name: "unknown", want: 100},
+		{name: "positive weight passing", states: map[string]health.State{"web": health.StatePassing}, want: 110},
+		{name: "positive weight failing", states: map[string]health.State{"web": health.StateFailing}, want: 100},
+		{name: "negative weight failing", states: map[string]health.State{"db": health.StateFailing}, want: 80},
+		{name: "negative weight passing", states: map[string]health.State{"db": health.StatePassing}, want: 100},
+		{name: "combined", states: map[string]health.State{"web": health.StatePassing, "db": health.StateFailing}, want: 90},
+		{name: "unweighted failing", states: map[string]health.State{"web": health.StatePassing, "disk": health.StateFailing}, want: 110},
+	}
+	for _, tt := range tests {
+		c := newTestCluster(t, checks...)
+		for name, state := range tt.states {
+			setState(t, c, name, state)
+		}
+		if got := c.score(); got != tt.want {
+			t.Errorf("%s: score = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSuccessor(t *testing.T) {
+	c := &Cluster{
+		LocalPeer:   RaftPeer{ID: "s1"},
+		RemotePeers: []RaftPeer{{ID: "s2"}, {ID: "s3"}, {ID: "s4"}},
+	}
+	tests := []struct {
+		name    string
+		members []MemberHealth
+		want    string // 为空时没有后继
+	}{
+		{name: "highest score", members: []MemberHealth{
+			{ID: "s2", Score: 90, Healthy: true}, {ID: "s3", Score: 120, Healthy: true}, {ID: "s4", Score: 100, Healthy: true},
+		}, want: "s3"},
+		{name: "tie in configured order", members: []MemberHealth{
+			{ID: "s2", Score: 90, Healthy: true}, {ID: "s3", Score: 100, Healthy: true}, {ID: "s4", Score: 100, Healthy: true},
+		}, want: "s3"},
+		{name: "unhealthy excluded", members: []MemberHealth{
+			{ID: "s2", Score: 90, Healthy: true}, {ID: "s3", Score: 120}, {ID: "s4", Score: 100, Healthy: true},
+		}, want: "s4"},
+		{name: "missing excluded", members: []MemberHealth{
+			{ID: "s2", Score: 90, Healthy: true},
+		}, want: "s2"},
+		{name: "local member excluded", members: []MemberHealth{
+			{ID: "s1", Score: 200, Healthy: true}, {ID: "s2", Score: 90, Healthy: true},
+		}, want: "s2"},
+		{name: "none healthy", members: []MemberHealth{
+			{ID: "s2", Score: 90}, {ID: "s3", Score: 100},
+		}},
+	}
+	for _, tt := range tests {
+		members := make(map[string]MemberHealth)
+		for _, member := range tt.members {
+			members[member.ID] = member
+		}
+		got := c.successor(members)
+		switch {
+		case tt.want == "" && got != nil:
+			t.Errorf("%s: successor = %s, want none", tt.name, got.ID)
+		case tt.want != "" && (got == nil || got.ID != tt.want):
+			t.Errorf("%s: successor = %v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSuccessorSkipsStaleMembers(t *testing.T) {
+	defer func(interval int) { setting.Config.ChecksInterval = interval }(setting.Config.ChecksInterval)
+	setting.Config.ChecksInterval = 1
+	c := newTestCluster(t)
+	c.RemotePeers = []RaftPeer{{ID: "s2"}, {ID: "s3"}}
+	c.peers.members = map[string]MemberHealth{
+		"s2": {ID: "s2", Score: 90, Healthy: true},
+		"s3": {ID: "s3", Score: 120, Healthy: true},
+	}
+	c.peers.fetched = map[string]time.Time{
+		"s2": time.Now(),
+		"s3": time.Now().Add(-time.Minute),
+	}
+	members := c.collectHealth()
+	if _, ok := members["s3"]; ok {
+		t.Fatal("stale member s3 was collected")
+	}
+	if !members["s1"].Healthy || members["s1"].Score != 100 {
+		t.Fatalf("local member = %+v, want healthy with score 100", members["s1"])
+	}
+	if successor := c.successor(members); successor == nil || successor.ID != "s2" {
+		t.Fatalf("successor = %v, want s2", successor)
+	}
+}
+
+// blockingFuture - 在release关闭前不返回结果的Raft操作
+type blockingFuture struct {
+	release chan struct{}
+	err     error
+}
+
+func (f *blockingFuture) Error() error {
+	<-f.release
+	return f.err
+}
+
+func TestWaitFuture(t *testing.T) {
+	future := &blockingFuture{release: make(chan struct{}), err: raft.ErrNotLeader}
+	start := time.Now()
+	if err := waitFuture(future, 50*time.Millisecond); err == nil {
+		t.Fatal("waitFuture returned nil for an unfinished operation")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("waitFuture returned after %s, want about 50ms", elapsed)
+	}
+	close(future.release)
+	if err := waitFuture(future, time.Second); err != raft.ErrNotLeader {
+		t.Fatalf("waitFuture = %v, want %v", err, raft.ErrNotLeader)
+	}
+}
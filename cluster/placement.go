@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"keep-vip/pkg/health"
+	"keep-vip/pkg/zlog"
+	"keep-vip/setting"
+	"time"
+)
+
+// placement - 是否为放置模式: VIP绑定到placement_check为passing的成员, 由Leader分配, 不绑定到Leader
+func (c *Cluster) placement() bool {
+	return setting.Config.PlacementCheck != ""
+}
+
+// placementGrace - 旧的持有者无法访问时, 等待其失去Leader联系自行释放VIP的时间
+func placementGrace() time.Duration {
+	grace := time.Second * time.Duration(3*setting.Config.ChecksInterval)
+	if grace < 5*time.Second {
+		grace = 5 * time.Second
+	}
+	return grace
+}
+
+// checkPlacement - 校验placement_check是否存在. 放置检查不能属于检查组, 否则检查组会让放置检查决定节点健康
+func (c *Cluster) checkPlacement() error {
+	if !c.placement() {
+		return nil
+	}
+	name := setting.Config.PlacementCheck
+	if c.check(name) == nil && c.checkGroup(name) == nil {
+		return errors.Errorf("placement_check references unknown check: %s", name)
+	}
+	for _, group := range c.checkGroups {
+		for _, member := range group.Checks {
+			if member == name {
+				return errors.Errorf("placement_check %s cannot be a member of check group %s", name, group.Name)
+			}
+		}
+	}
+	if c.LocalPeer.APIAddress == "" {
+		zlog.Warn("Placement mode requires apiAddress of members, this member will never hold the vips")
+	}
+	return nil
+}
+
+// bound - 本节点是否绑定了任意VIP
+func (c *Cluster) bound() bool {
+	for _, group := range c.VipGroups {
+		for _, vip := range group.Vips {
+			if exist, err := vip.IsExist(); err == nil && exist {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evaluatePlacement - 在集群循环中调用. Leader分配VIP持有者, 所有成员根据状态机中的持有者绑定或释放VIP
+func (c *Cluster) evaluatePlacement(isLeader bool) {
+	if isLeader && !c.exiting {
+		c.assignHolder()
+	} else {
+		c.holderCleared = time.Time{}
+	}
+	c.placeVips()
+}
+
+// placeVips - 状态机中的持有者为本节点, 能联系到Leader且placement_check为passing(或者集群冻结)时绑定VIP, 否则释放VIP
+func (c *Cluster) placeVips() {
+	leaderAddr, _ := c.raft.LeaderWithID()
+	if leaderAddr != "" && c.stateMachine.Holder() == c.LocalPeer.ID &&
+		(c.state(setting.Config.PlacementCheck) == health.StatePassing || c.frozen()) {
+		c.acquireVips()
+		return
+	}
+	c.releaseVips()
+}
+
+// assignHolder - 选择VIP持有者写入状态机. 持有者变化时先清空, 旧的持有者释放VIP后再分配, 保证VIP不会同时绑定到多个成员
+func (c *Cluster) assignHolder() {
+	members := c.collectHealth()
+	if err := c.applyHealth(members); err != nil {
+		zlog.Error(errors.WithMessage(err, "apply member health"))
+	}
+	// 集群冻结期间保持当前的持有者
+	if c.frozen() {
+		return
+	}
+	qualified := func(id string) bool {
+		member, ok := members[id]
+		return ok && member.Healthy && member.Checks[setting.Config.PlacementCheck] == health.StatePassing.String()
+	}
+
+	holder := c.stateMachine.Holder()
+	if holder != "" {
+		if qualified(holder) {
+			return
+		}
+		zlog.Warn(fmt.Sprintf("Member %s no longer qualifies for placement, releasing vips", holder))
+		c.holderCleared = time.Now()
+		if err := c.applyHolder(""); err != nil {
+			zlog.Error(errors.WithMessage(err, "apply vip holder"))
+		}
+		return
+	}
+
+	// 选择分数最高的合格成员, 分数相同时按配置顺序
+	var candidate string
+	for _, peer := range append([]RaftPeer{c.LocalPeer}, c.RemotePeers...) {
+		if qualified(peer.ID) && (candidate == "" || members[peer.ID].Score > members[candidate].Score) {
+			candidate = peer.ID
+		}
+	}
+	if candidate == "" {
+		zlog.Warn(fmt.Sprintf("No member passes placement check %s, refuse to assign vips", setting.Config.PlacementCheck))
+		return
+	}
+
+	// 等待所有成员释放VIP, 无法访问的成员等待其失去Leader联系
+	if c.holderCleared.IsZero() {
+		c.holderCleared = time.Now()
+	}
+	released := len(members) == len(c.RemotePeers)+1
+	for _, member := range members {
+		if member.Holding {
+			released = false
+		}
+	}
+	if !released && time.Since(c.holderCleared) < placementGrace() {
+		zlog.Info(fmt.Sprintf("Waiting for members to release vips before assigning to %s", candidate))
+		return
+	}
+	zlog.Warn(fmt.Sprintf("Assigning vips to member %s", candidate))
+	if err := c.applyHolder(candidate); err != nil {
+		zlog.Error(errors.WithMessage(err, "apply vip holder"))
+	}
+}
+
+// applyHolder - 写入VIP持有者到状态机
+func (c *Cluster) applyHolder(holder string) error {
+	return c.apply(command{Op: opSetHolder, Holder: holder})
+}
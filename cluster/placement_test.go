@@ -0,0 +1,76 @@
+package cluster
+
+import (
+	"keep-vip/pkg/health"
+	"keep-vip/setting"
+	"testing"
+)
+
+func TestCheckPlacement(t *testing.T) {
+	checks := []setting.Check{{Name: "web"}, {Name: "pg_primary"}}
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{name: "disabled", config: `placement_check: ""`},
+		{name: "check", config: `placement_check: pg_primary`},
+		{name: "unknown", config: `placement_check: pg`, wantErr: true},
+		{name: "group", config: `
+placement_check: db
+checkGroups:
+  - name: db
+    checks: [pg_primary]`},
+		{name: "group member", config: `
+placement_check: pg_primary
+checkGroups:
+  - name: node
+    checks: [web, pg_primary]`, wantErr: true},
+		{name: "nested group member", config: `
+placement_check: db
+checkGroups:
+  - name: db
+    checks: [pg_primary]
+  - name: node
+    checks: [web, db]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		loadConfig(t, tt.config)
+		c := newTestCluster(t, checks...)
+		groups, err := newCheckGroups(c.checks)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		c.checkGroups = groups
+		if err := c.checkPlacement(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkPlacement error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPlacementCheckNotDecision(t *testing.T) {
+	loadConfig(t, `
+placement_check: db
+checkGroups:
+  - name: db
+    checks: [pg_primary]
+`)
+	c := newTestCluster(t, setting.Check{Name: "web"}, setting.Check{Name: "pg_primary"})
+	groups, err := newCheckGroups(c.checks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.checkGroups = groups
+	if err := c.checkPlacement(); err != nil {
+		t.Fatal(err)
+	}
+	// 非持有者上放置检查为failing, 节点仍然健康
+	setState(t, c, "web", health.StatePassing)
+	setState(t, c, "pg_primary", health.StateFailing)
+	if decisions := c.decisions(); len(decisions) != 1 || decisions[0] != "web" {
+		t.Fatalf("decisions = %v, want [web]", decisions)
+	}
+	if !c.healthy() {
+		t.Fatal("failing placement check made the node unhealthy")
+	}
+}
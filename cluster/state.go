@@ -1,37 +1,174 @@
 package cluster
 
 import (
+	"encoding/json"
 	"io"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/raft"
+	"github.com/pkg/errors"
 )
 
+// 状态机命令
+const (
+	opSetHealth = "set_health" // Leader更新所有成员的健康状态
+	opSetHolder = "set_holder" // Leader分配VIP持有者, 放置模式有效
+	opSetFreeze = "set_freeze" // 冻结集群, freeze为空时解除冻结
+)
+
+// command - 写入Raft日志的命令
+type command struct {
+	Op      string                  `json:"op"`
+	Members map[string]MemberHealth `json:"members,omitempty"`
+	Holder  string                  `json:"holder,omitempty"`
+	Freeze  *Freeze                 `json:"freeze,omitempty"`
+}
+
+// Freeze - 集群冻结: 检查不再触发Leader转移和VIP释放, 保持当前的VIP持有者
+type Freeze struct {
+	Reason  string    `json:"reason"`
+	Created time.Time `json:"created"`
+	Until   time.Time `json:"until"` // 过期后自动解除
+}
+
+// MemberHealth - 成员健康状态, 由Leader收集后通过Raft复制到所有成员
+type MemberHealth struct {
+	ID          string            `json:"id"`
+	Priority    int               `json:"priority"`
+	Score       int               `json:"score"`   // priority加上加权检查的权重
+	Healthy     bool              `json:"healthy"` // 没有failing的非加权检查, 可以成为Leader
+	Checks      map[string]string `json:"checks,omitempty"`
+	Holding     bool              `json:"holding"` // 是否绑定了VIP
+	Maintenance bool              `json:"maintenance"`
+	Updated     time.Time         `json:"updated"`
+}
+
+// fsmState - 状态机数据, 快照时整体序列化
+type fsmState struct {
+	Members map[string]MemberHealth `json:"members"`
+	Holder  string                  `json:"holder"` // VIP持有者, 为空时所有成员释放VIP
+	Freeze  *Freeze                 `json:"freeze,omitempty"`
+}
+
 // FSM - Finite State Machine for Raft
 type FSM struct {
+	mu      sync.RWMutex
+	state   fsmState
+	changes chan struct{}
+}
+
+// NewFSM - 创建状态机
+func NewFSM() *FSM {
+	return &FSM{
+		state:   fsmState{Members: make(map[string]MemberHealth)},
+		changes: make(chan struct{}, 1),
+	}
 }
 
-// Apply - TODO
-func (fsm FSM) Apply(log *raft.Log) interface{} {
+// Apply - 应用Raft日志中的命令
+func (fsm *FSM) Apply(log *raft.Log) interface{} {
+	if log.Type != raft.LogCommand {
+		return nil
+	}
+	var cmd command
+	if err := json.Unmarshal(log.Data, &cmd); err != nil {
+		return errors.WithStack(err)
+	}
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	switch cmd.Op {
+	case opSetHealth:
+		fsm.state.Members = cmd.Members
+	case opSetHolder:
+		fsm.state.Holder = cmd.Holder
+		fsm.notify()
+	case opSetFreeze:
+		fsm.state.Freeze = cmd.Freeze
+	default:
+		return errors.Errorf("unknown fsm command: %s", cmd.Op)
+	}
 	return nil
 }
 
-// Restore - TODO
-func (fsm FSM) Restore(snap io.ReadCloser) error {
+// Restore - 从快照恢复状态
+func (fsm *FSM) Restore(snap io.ReadCloser) error {
+	defer snap.Close()
+	state := fsmState{Members: make(map[string]MemberHealth)}
+	if err := json.NewDecoder(snap).Decode(&state); err != nil {
+		return errors.WithStack(err)
+	}
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	fsm.state = state
+	fsm.notify()
 	return nil
 }
 
-// Snapshot - TODO, returns an empty snapshot
-func (fsm FSM) Snapshot() (raft.FSMSnapshot, error) {
-	return Snapshot{}, nil
+// Snapshot - 返回当前状态的快照
+func (fsm *FSM) Snapshot() (raft.FSMSnapshot, error) {
+	fsm.mu.RLock()
+	defer fsm.mu.RUnlock()
+	data, err := json.Marshal(fsm.state)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return Snapshot{data: data}, nil
 }
 
-// Snapshot -
+// Members - 返回所有成员的健康状态
+func (fsm *FSM) Members() map[string]MemberHealth {
+	fsm.mu.RLock()
+	defer fsm.mu.RUnlock()
+	members := make(map[string]MemberHealth, len(fsm.state.Members))
+	for id, member := range fsm.state.Members {
+		members[id] = member
+	}
+	return members
+}
+
+// Holder - 返回VIP持有者
+func (fsm *FSM) Holder() string {
+	fsm.mu.RLock()
+	defer fsm.mu.RUnlock()
+	return fsm.state.Holder
+}
+
+// Freeze - 返回未过期的集群冻结, 没有冻结返回nil
+func (fsm *FSM) Freeze() *Freeze {
+	fsm.mu.RLock()
+	defer fsm.mu.RUnlock()
+	if fsm.state.Freeze == nil || !time.Now().Before(fsm.state.Freeze.Until) {
+		return nil
+	}
+	freeze := *fsm.state.Freeze
+	return &freeze
+}
+
+// Changes - VIP持有者变化时收到通知
+func (fsm *FSM) Changes() <-chan struct{} {
+	return fsm.changes
+}
+
+func (fsm *FSM) notify() {
+	select {
+	case fsm.changes <- struct{}{}:
+	default:
+	}
+}
+
+// Snapshot - 序列化后的状态
 type Snapshot struct {
+	data []byte
 }
 
-// Persist -
+// Persist - 写入快照
 func (snapshot Snapshot) Persist(sink raft.SnapshotSink) error {
-	return nil
+	if _, err := sink.Write(snapshot.data); err != nil {
+		_ = sink.Cancel()
+		return errors.WithStack(err)
+	}
+	return sink.Close()
 }
 
 // Release -
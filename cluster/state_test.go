@@ -0,0 +1,93 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// applyCommand - 应用一条命令到状态机
+func applyCommand(t *testing.T, fsm *FSM, cmd command) interface{} {
+	t.Helper()
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fsm.Apply(&raft.Log{Type: raft.LogCommand, Data: data})
+}
+
+// bufferSink - 写入内存的快照
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) ID() string    { return "test" }
+func (s *bufferSink) Cancel() error { return nil }
+func (s *bufferSink) Close() error  { return nil }
+
+func TestFSMFreeze(t *testing.T) {
+	fsm := NewFSM()
+	if fsm.Freeze() != nil {
+		t.Fatal("new fsm is frozen")
+	}
+	now := time.Now()
+	freeze := &Freeze{Reason: "upgrade", Created: now, Until: now.Add(time.Hour)}
+	if result := applyCommand(t, fsm, command{Op: opSetFreeze, Freeze: freeze}); result != nil {
+		t.Fatalf("apply = %v", result)
+	}
+	if got := fsm.Freeze(); got == nil || got.Reason != "upgrade" || !got.Until.Equal(freeze.Until) {
+		t.Fatalf("Freeze = %+v, want %+v", got, freeze)
+	}
+
+	// 过期后自动解除
+	expired := &Freeze{Reason: "expired", Created: now.Add(-time.Hour), Until: now.Add(-time.Second)}
+	applyCommand(t, fsm, command{Op: opSetFreeze, Freeze: expired})
+	if got := fsm.Freeze(); got != nil {
+		t.Fatalf("Freeze = %+v after expiry, want nil", got)
+	}
+
+	applyCommand(t, fsm, command{Op: opSetFreeze, Freeze: freeze})
+	applyCommand(t, fsm, command{Op: opSetFreeze})
+	if got := fsm.Freeze(); got != nil {
+		t.Fatalf("Freeze = %+v after unfreeze, want nil", got)
+	}
+
+	if result := applyCommand(t, fsm, command{Op: "unknown"}); result == nil {
+		t.Fatal("apply accepted an unknown command")
+	}
+}
+
+func TestFSMSnapshotRestore(t *testing.T) {
+	fsm := NewFSM()
+	now := time.Now()
+	applyCommand(t, fsm, command{Op: opSetFreeze, Freeze: &Freeze{Reason: "upgrade", Created: now, Until: now.Add(time.Hour)}})
+	applyCommand(t, fsm, command{Op: opSetHolder, Holder: "s2"})
+	applyCommand(t, fsm, command{Op: opSetHealth, Members: map[string]MemberHealth{"s2": {ID: "s2", Score: 100, Healthy: true}}})
+
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &bufferSink{}
+	if err := snapshot.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewFSM()
+	if err := restored.Restore(io.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	if freeze := restored.Freeze(); freeze == nil || freeze.Reason != "upgrade" {
+		t.Fatalf("restored Freeze = %+v, want upgrade", freeze)
+	}
+	if holder := restored.Holder(); holder != "s2" {
+		t.Fatalf("restored Holder = %q, want s2", holder)
+	}
+	if member := restored.Members()["s2"]; !member.Healthy || member.Score != 100 {
+		t.Fatalf("restored member = %+v", member)
+	}
+}
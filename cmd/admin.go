@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// adminRequest - 请求本机管理接口, 返回响应内容
+func adminRequest(method, path string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", adminAddress, path), reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		var result struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(data, &result); err == nil && result.Error != "" {
+			return nil, errors.New(result.Error)
+		}
+		return nil, errors.Errorf("admin api returned %s", response.Status)
+	}
+	return data, nil
+}
+
+// printJSON - 格式化输出JSON
+func printJSON(data []byte) error {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Println(buf.String())
+	return nil
+}
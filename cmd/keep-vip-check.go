@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"keep-vip/cluster"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	overrideMode   string
+	overrideTTL    time.Duration
+	overrideReason string
+)
+
+func init() {
+	keepVipCheckOverride.Flags().StringVar(&overrideMode, "mode", "pause", "Override mode. One of: [pause|pass|fail]")
+	keepVipCheckOverride.Flags().DurationVar(&overrideTTL, "ttl", 30*time.Minute, "The override reverts automatically after ttl")
+	keepVipCheckOverride.Flags().StringVar(&overrideReason, "reason", "", "Reason shown in status")
+
+	keepVipCheck.AddCommand(keepVipCheckOverride)
+	keepVipCheck.AddCommand(keepVipCheckClear)
+	keepVipCheck.AddCommand(keepVipCheckOverrides)
+}
+
+var keepVipCheck = &cobra.Command{
+	Use:   "check",
+	Short: "Pause or override checks of the local keep-vip node",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var keepVipCheckOverride = &cobra.Command{
+	Use:   "override <check>",
+	Short: "Pause a check or force its result to pass or fail until the ttl expires",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := adminRequest(http.MethodPut, overridePath(args[0]), cluster.OverrideRequest{
+			Mode:   overrideMode,
+			TTL:    overrideTTL.String(),
+			Reason: overrideReason,
+		})
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	},
+}
+
+var keepVipCheckClear = &cobra.Command{
+	Use:   "clear <check>",
+	Short: "Remove the override of a check",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := adminRequest(http.MethodDelete, overridePath(args[0]), nil); err != nil {
+			return err
+		}
+		fmt.Printf("Override of check %s removed\n", args[0])
+		return nil
+	},
+}
+
+var keepVipCheckOverrides = &cobra.Command{
+	Use:   "overrides",
+	Short: "List the current overrides",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := adminRequest(http.MethodGet, "/v1/overrides", nil)
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	},
+}
+
+// overridePath - 检查覆盖的接口路径
+func overridePath(check string) string {
+	return fmt.Sprintf("/v1/checks/%s/override", url.PathEscape(check))
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"keep-vip/cluster"
+	"net/http"
+)
+
+var drainReason string
+
+func init() {
+	keepVipDrain.Flags().StringVar(&drainReason, "reason", "", "Reason shown in status")
+}
+
+var keepVipDrain = &cobra.Command{
+	Use:   "drain",
+	Short: "Take the local node out of rotation: release the vips, give up leadership and stop accepting new connections",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := adminRequest(http.MethodPut, "/v1/drain", cluster.DrainRequest{Reason: drainReason})
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	},
+}
+
+var keepVipResume = &cobra.Command{
+	Use:   "resume",
+	Short: "Return the local node to service after drain",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := adminRequest(http.MethodDelete, "/v1/drain", nil)
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	},
+}
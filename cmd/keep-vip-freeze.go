@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"keep-vip/cluster"
+	"net/http"
+	"time"
+)
+
+var (
+	freezeTTL    time.Duration
+	freezeReason string
+)
+
+func init() {
+	keepVipFreeze.Flags().DurationVar(&freezeTTL, "ttl", time.Hour, "The freeze ends automatically after ttl")
+	keepVipFreeze.Flags().StringVar(&freezeReason, "reason", "", "Reason shown in status")
+}
+
+var keepVipFreeze = &cobra.Command{
+	Use:   "freeze",
+	Short: "Freeze the cluster: checks no longer move the vips or leadership",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := adminRequest(http.MethodPut, "/v1/freeze", cluster.FreezeRequest{
+			TTL:    freezeTTL.String(),
+			Reason: freezeReason,
+		})
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	},
+}
+
+var keepVipUnfreeze = &cobra.Command{
+	Use:   "unfreeze",
+	Short: "End the cluster freeze",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := adminRequest(http.MethodDelete, "/v1/freeze", nil); err != nil {
+			return err
+		}
+		fmt.Println("Cluster freeze ended")
+		return nil
+	},
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"net/http"
+)
+
+var keepVipStatus = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the local keep-vip node",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := adminRequest(http.MethodGet, "/v1/status", nil)
+		if err != nil {
+			return err
+		}
+		return printJSON(data)
+	},
+}
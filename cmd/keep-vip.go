@@ -15,17 +15,25 @@ var keepVipCmd = &cobra.Command{
 }
 
 var (
-	logEncoder string
-	logLevel   string
+	logEncoder   string
+	logLevel     string
+	adminAddress string
 )
 
 func init() {
 	// 命令行参数
 	keepVipCmd.PersistentFlags().StringVar(&logEncoder, "log-encoder", "console", "Output Encoder. One of: [console|json]")
 	keepVipCmd.PersistentFlags().StringVar(&logLevel, "log-level", "debug", "Log Level. Ond of: [debug|info|warn|error]")
+	keepVipCmd.PersistentFlags().StringVar(&adminAddress, "admin-address", "127.0.0.1:9196", "Address of the local keep-vip admin api")
 
 	// 添加子命令
 	keepVipCmd.AddCommand(keepVipStart)
+	keepVipCmd.AddCommand(keepVipStatus)
+	keepVipCmd.AddCommand(keepVipCheck)
+	keepVipCmd.AddCommand(keepVipDrain)
+	keepVipCmd.AddCommand(keepVipResume)
+	keepVipCmd.AddCommand(keepVipFreeze)
+	keepVipCmd.AddCommand(keepVipUnfreeze)
 }
 
 // Execute - 命令解析
@@ -0,0 +1,183 @@
+package firewall
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"keep-vip/pkg/zlog"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// DefaultTable - keep-vip管理的nftables表名
+const DefaultTable = "keep_vip"
+
+// chain - nftables基础链定义
+type chain struct {
+	Type     string
+	Hook     string
+	Priority int
+}
+
+// chains - 支持的链, 链名即hook名
+var chains = map[string]chain{
+	"prerouting":  {Type: "nat", Hook: "prerouting", Priority: -100},
+	"output":      {Type: "nat", Hook: "output", Priority: -100},
+	"postrouting": {Type: "nat", Hook: "postrouting", Priority: 100},
+	"input":       {Type: "filter", Hook: "input", Priority: 0},
+	"forward":     {Type: "filter", Hook: "forward", Priority: 0},
+}
+
+// chainOrder - 生成规则时链的顺序
+var chainOrder = []string{"prerouting", "input", "forward", "output", "postrouting"}
+
+// Rule - 一条nftables规则
+type Rule struct {
+	Name  string
+	Chain string
+	Rule  string // nft规则语句, 例如: tcp dport 80 dnat to 10.0.0.5:8080
+}
+
+// Status - 规则安装状态
+type Status struct {
+	Table     string `json:"table"`
+	Rules     int    `json:"rules"`
+	Installed bool   `json:"installed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Nftables - Leader绑定VIP时安装规则, 释放VIP时清空规则
+type Nftables struct {
+	mu        sync.Mutex
+	table     string
+	rules     []Rule
+	installed bool
+	flushed   bool // 启动后是否清空过, 清理上次异常退出残留的规则
+	lastErr   error
+}
+
+// NewNftables - 校验规则并创建nftables管理
+func NewNftables(table string, rules []Rule) (*Nftables, error) {
+	if table == "" {
+		table = DefaultTable
+	}
+	for _, rule := range rules {
+		if _, ok := chains[strings.ToLower(rule.Chain)]; !ok {
+			return nil, errors.Errorf("firewall rule %s the chain is not supported: %s", rule.Name, rule.Chain)
+		}
+		if strings.TrimSpace(rule.Rule) == "" {
+			return nil, errors.Errorf("firewall rule %s cannot be blank", rule.Name)
+		}
+		if strings.ContainsAny(rule.Rule, "\n;{}") {
+			return nil, errors.Errorf("firewall rule %s must be a single statement", rule.Name)
+		}
+	}
+	if _, err := exec.LookPath("nft"); err != nil {
+		return nil, errors.Wrap(err, "nftables rules configured but nft command not found")
+	}
+	return &Nftables{
+		table: table,
+		rules: rules,
+	}, nil
+}
+
+// Install - 原子替换keep-vip表中的规则. 已安装且表存在则跳过, 表被外部删除(nft flush ruleset, firewalld reload)时重新安装
+func (n *Nftables) Install() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.installed {
+		if n.exists() {
+			return nil
+		}
+		zlog.Warn(fmt.Sprintf("nftables table ip %s was removed externally, reinstalling", n.table))
+		n.installed = false
+	}
+	zlog.Debug(fmt.Sprintf("Install nftables rules in table ip %s", n.table))
+	if err := nft(n.script()); err != nil {
+		n.lastErr = errors.WithMessagef(err, "install nftables table %s failed", n.table)
+		return n.lastErr
+	}
+	n.installed = true
+	n.flushed = false
+	n.lastErr = nil
+	return nil
+}
+
+// Flush - 删除keep-vip表, 未安装过则跳过
+func (n *Nftables) Flush() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.installed && n.flushed {
+		return nil
+	}
+	zlog.Debug(fmt.Sprintf("Flush nftables table ip %s", n.table))
+	// 先声明再删除, 表不存在时也不会报错
+	if err := nft(fmt.Sprintf("table ip %s\ndelete table ip %s\n", n.table, n.table)); err != nil {
+		n.lastErr = errors.WithMessagef(err, "flush nftables table %s failed", n.table)
+		return n.lastErr
+	}
+	n.installed = false
+	n.flushed = true
+	n.lastErr = nil
+	return nil
+}
+
+// Status - 返回规则安装状态
+func (n *Nftables) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	status := Status{
+		Table:     n.table,
+		Rules:     len(n.rules),
+		Installed: n.installed,
+	}
+	if n.lastErr != nil {
+		status.Error = n.lastErr.Error()
+	}
+	return status
+}
+
+// exists - keep-vip表是否存在
+func (n *Nftables) exists() bool {
+	return exec.Command("nft", "list", "table", "ip", n.table).Run() == nil
+}
+
+// script - 生成nft脚本, 删除旧表后重建, nft -f 保证原子性
+func (n *Nftables) script() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "table ip %s\n", n.table)
+	fmt.Fprintf(&buf, "delete table ip %s\n", n.table)
+	fmt.Fprintf(&buf, "table ip %s {\n", n.table)
+	for _, name := range chainOrder {
+		var rules []Rule
+		for _, rule := range n.rules {
+			if strings.ToLower(rule.Chain) == name {
+				rules = append(rules, rule)
+			}
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		c := chains[name]
+		fmt.Fprintf(&buf, "\tchain %s {\n", name)
+		fmt.Fprintf(&buf, "\t\ttype %s hook %s priority %d; policy accept;\n", c.Type, c.Hook, c.Priority)
+		for _, rule := range rules {
+			fmt.Fprintf(&buf, "\t\t%s comment %q\n", strings.TrimSpace(rule.Rule), rule.Name)
+		}
+		buf.WriteString("\t}\n")
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// nft - 通过标准输入执行nft脚本
+func nft(script string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Errorf("nft: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 数据库角色
+const (
+	RolePrimary = "primary" // 可写的主库
+	RoleReplica = "replica" // 只读的从库
+)
+
+// DatabaseOptions - 数据库角色检查配置
+type DatabaseOptions struct {
+	Address  string // host:port
+	User     string
+	Password string
+	Database string
+	Role     string // primary|replica(默认:primary)
+	SSLMode  string // 仅PostgreSQL有效: disable|prefer|require|verify-ca|verify-full(默认:prefer)
+	Timeout  int    // 单位s, 连接和查询的总超时时间
+}
+
+// role - 校验并返回期望的角色
+func (o DatabaseOptions) role() (string, error) {
+	switch role := strings.ToLower(o.Role); role {
+	case "":
+		return RolePrimary, nil
+	case RolePrimary, RoleReplica:
+		return role, nil
+	default:
+		return "", errors.Errorf("unsupported database role: %s", o.Role)
+	}
+}
+
+// SQLChecker - 连接数据库查询角色, 角色符合预期为健康
+type SQLChecker struct {
+	driver   string
+	dsn      string
+	fallback string // 服务端不支持TLS时使用的dsn, 为空不重试
+	address  string
+	query    string
+	primary  func(value int64) bool // 根据查询结果判断是否为主库
+	role     string
+	timeout  time.Duration
+}
+
+// NewPostgresChecker - 查询pg_is_in_recovery(), 不在恢复中为主库
+func NewPostgresChecker(o DatabaseOptions) (*SQLChecker, error) {
+	host, port, err := net.SplitHostPort(o.Address)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	role, err := o.role()
+	if err != nil {
+		return nil, err
+	}
+	timeout := Timeout(o.Timeout)
+	dsn := func(sslMode string) string {
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(o.User, o.Password),
+			Host:     net.JoinHostPort(host, port),
+			Path:     "/" + o.Database,
+			RawQuery: url.Values{"sslmode": {sslMode}, "connect_timeout": {fmt.Sprint(int(timeout.Seconds() + 0.5))}}.Encode(),
+		}
+		return dsn.String()
+	}
+	checker := &SQLChecker{
+		driver:  "postgres",
+		address: o.Address,
+		// pg_is_in_recovery()返回bool, 转换为整数便于和MySQL共用
+		query: "SELECT CASE WHEN pg_is_in_recovery() THEN 1 ELSE 0 END",
+		primary: func(value int64) bool {
+			return value == 0
+		},
+		role:    role,
+		timeout: timeout,
+	}
+	// lib/pq不支持prefer: 先使用TLS, 服务端不支持时使用明文
+	switch sslMode := strings.ToLower(o.SSLMode); sslMode {
+	case "", "prefer":
+		checker.dsn = dsn("require")
+		checker.fallback = dsn("disable")
+	case "disable", "require", "verify-ca", "verify-full":
+		checker.dsn = dsn(sslMode)
+	default:
+		return nil, errors.Errorf("unsupported postgres ssl mode: %s", o.SSLMode)
+	}
+	return checker, nil
+}
+
+// NewMySQLChecker - 查询@@global.read_only, 非只读为主库
+func NewMySQLChecker(o DatabaseOptions) (*SQLChecker, error) {
+	if _, _, err := net.SplitHostPort(o.Address); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	role, err := o.role()
+	if err != nil {
+		return nil, err
+	}
+	timeout := Timeout(o.Timeout)
+	config := mysql.NewConfig()
+	config.User = o.User
+	config.Passwd = o.Password
+	config.Net = "tcp"
+	config.Addr = o.Address
+	config.DBName = o.Database
+	config.Timeout = timeout
+	config.ReadTimeout = timeout
+	config.WriteTimeout = timeout
+	return &SQLChecker{
+		driver:  "mysql",
+		dsn:     config.FormatDSN(),
+		address: o.Address,
+		query:   "SELECT @@global.read_only",
+		primary: func(value int64) bool {
+			return value == 0
+		},
+		role:    role,
+		timeout: timeout,
+	}, nil
+}
+
+// Check - 建立连接并查询角色
+func (s *SQLChecker) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	value, err := s.queryRole(ctx, s.dsn)
+	if err != nil && s.fallback != "" && errors.Is(err, pq.ErrSSLNotSupported) {
+		value, err = s.queryRole(ctx, s.fallback)
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || isTimeout(err) {
+			return failure(ReasonTimeout, errors.Wrapf(err, "query %s %s", s.driver, s.address))
+		}
+		return failure(ReasonConnect, errors.Wrapf(err, "query %s %s", s.driver, s.address))
+	}
+	return checkRole(s.address, s.role, s.primary(value))
+}
+
+// queryRole - 使用新连接查询角色
+func (s *SQLChecker) queryRole(ctx context.Context, dsn string) (int64, error) {
+	db, err := sql.Open(s.driver, dsn)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer db.Close()
+	// 每次检查使用新连接, 不保留空闲连接
+	db.SetMaxIdleConns(0)
+
+	var value int64
+	err = db.QueryRowContext(ctx, s.query).Scan(&value)
+	return value, err
+}
+
+// checkRole - 比较实际角色和期望的角色
+func checkRole(address, expect string, primary bool) error {
+	actual := RoleReplica
+	if primary {
+		actual = RolePrimary
+	}
+	if actual != expect {
+		return failure(ReasonRole, errors.Errorf("%s role is %s, expect %s", address, actual, expect))
+	}
+	return nil
+}
+
+// isTimeout - 是否为网络超时错误
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,125 @@
+package health
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseRole(t *testing.T) {
+	tests := []struct {
+		role    string
+		want    string
+		wantErr bool
+	}{
+		{role: "", want: RolePrimary},
+		{role: "primary", want: RolePrimary},
+		{role: "Replica", want: RoleReplica},
+		{role: "master", wantErr: true},
+		{role: "standby", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := DatabaseOptions{Role: tt.role}.role()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("role(%q) error = %v, wantErr %v", tt.role, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("role(%q) = %q, want %q", tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestCheckRole(t *testing.T) {
+	tests := []struct {
+		expect  string
+		primary bool
+		wantErr bool
+	}{
+		{expect: RolePrimary, primary: true},
+		{expect: RolePrimary, primary: false, wantErr: true},
+		{expect: RoleReplica, primary: false},
+		{expect: RoleReplica, primary: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		err := checkRole("127.0.0.1:5432", tt.expect, tt.primary)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkRole(%s, primary=%v) error = %v, wantErr %v", tt.expect, tt.primary, err, tt.wantErr)
+			continue
+		}
+		if err != nil && Reason(err) != ReasonRole {
+			t.Errorf("checkRole(%s, primary=%v) reason = %s, want %s", tt.expect, tt.primary, Reason(err), ReasonRole)
+		}
+	}
+}
+
+func TestPostgresSSLMode(t *testing.T) {
+	tests := []struct {
+		mode         string
+		dsn          string
+		withFallback bool
+		wantErr      bool
+	}{
+		{mode: "", dsn: "sslmode=require", withFallback: true},
+		{mode: "Prefer", dsn: "sslmode=require", withFallback: true},
+		{mode: "disable", dsn: "sslmode=disable"},
+		{mode: "verify-full", dsn: "sslmode=verify-full"},
+		{mode: "allow", wantErr: true},
+	}
+	for _, tt := range tests {
+		checker, err := NewPostgresChecker(DatabaseOptions{Address: "127.0.0.1:5432", SSLMode: tt.mode})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("sslMode %q: error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if !strings.Contains(checker.dsn, tt.dsn) {
+			t.Errorf("sslMode %q: dsn = %s, want %s", tt.mode, checker.dsn, tt.dsn)
+		}
+		if (checker.fallback != "") != tt.withFallback || (tt.withFallback && !strings.Contains(checker.fallback, "sslmode=disable")) {
+			t.Errorf("sslMode %q: fallback = %q", tt.mode, checker.fallback)
+		}
+	}
+}
+
+// TestPostgresPreferFallback - 服务端拒绝TLS时使用明文重新连接
+func TestPostgresPreferFallback(t *testing.T) {
+	listen, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listen.Close()
+	// 记录每个连接的第一个请求码: 80877103为SSLRequest, 196608为明文的StartupMessage
+	codes := make(chan uint32, 4)
+	go func() {
+		for {
+			conn, err := listen.Accept()
+			if err != nil {
+				return
+			}
+			header := make([]byte, 8)
+			if _, err := io.ReadFull(conn, header); err == nil {
+				code := binary.BigEndian.Uint32(header[4:])
+				codes <- code
+				if code == 80877103 {
+					conn.Write([]byte("N"))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	checker, err := NewPostgresChecker(DatabaseOptions{Address: listen.Addr().String(), Timeout: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.Check(); err == nil || Reason(err) != ReasonConnect {
+		t.Fatalf("Check = %v, want connect failure", err)
+	}
+	if first, second := <-codes, <-codes; first != 80877103 || second != 196608 {
+		t.Fatalf("request codes = %d, %d, want SSLRequest then StartupMessage", first, second)
+	}
+}
@@ -0,0 +1,163 @@
+package health
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNSOptions - DNS检查配置
+type DNSOptions struct {
+	Server  string   // host[:port], 默认端口53
+	Name    string   // 查询的域名
+	Type    string   // A|AAAA|CNAME|TXT, 默认A
+	Expect  []string // 期望的应答, 为空时只要求应答不为空
+	Timeout int      // 单位s
+}
+
+// DNSChecker - 向指定DNS服务器查询域名并校验应答
+type DNSChecker struct {
+	server  string
+	name    dnsmessage.Name
+	qtype   dnsmessage.Type
+	expect  []string
+	timeout time.Duration
+}
+
+var dnsTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+// NewDNSChecker - 校验配置并创建DNS检查
+func NewDNSChecker(o DNSOptions) (*DNSChecker, error) {
+	server := o.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	if o.Name == "" {
+		return nil, errors.New("dns query name cannot be blank")
+	}
+	name, err := dnsmessage.NewName(fqdn(o.Name))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	qtype := dnsmessage.TypeA
+	if o.Type != "" {
+		var ok bool
+		if qtype, ok = dnsTypes[strings.ToUpper(o.Type)]; !ok {
+			return nil, errors.Errorf("dns query type is not supported: %s", o.Type)
+		}
+	}
+	d := &DNSChecker{
+		server:  server,
+		name:    name,
+		qtype:   qtype,
+		timeout: Timeout(o.Timeout),
+	}
+	for _, expect := range o.Expect {
+		d.expect = append(d.expect, d.normalize(expect))
+	}
+	return d, nil
+}
+
+// Check - 发送查询并校验应答
+func (d *DNSChecker) Check() error {
+	id, err := randomID()
+	if err != nil {
+		return failure(ReasonError, err)
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: d.name, Type: d.qtype, Class: dnsmessage.ClassINET}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return failure(ReasonError, errors.WithStack(err))
+	}
+
+	conn, err := net.DialTimeout("udp", d.server, d.timeout)
+	if err != nil {
+		return failure(ReasonConnect, errors.WithStack(err))
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+		return failure(ReasonError, errors.WithStack(err))
+	}
+	if _, err := conn.Write(packet); err != nil {
+		return failure(ReasonConnect, errors.WithStack(err))
+	}
+
+	buf := make([]byte, 64*1024)
+	var response dnsmessage.Message
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return failure(requestReason(err), errors.Wrapf(err, "query %s from %s", d.name, d.server))
+		}
+		if err := response.Unpack(buf[:n]); err != nil {
+			return failure(ReasonAnswer, errors.WithStack(err))
+		}
+		// 忽略不匹配的应答
+		if response.ID == id && response.Response {
+			break
+		}
+	}
+	if response.RCode != dnsmessage.RCodeSuccess {
+		return failure(ReasonAnswer, errors.Errorf("query %s from %s: %s", d.name, d.server, response.RCode))
+	}
+
+	answers := make(map[string]bool)
+	for _, answer := range response.Answers {
+		if value, ok := answerValue(answer.Body); ok && answer.Header.Type == d.qtype {
+			answers[d.normalize(value)] = true
+		}
+	}
+	if len(answers) == 0 {
+		return failure(ReasonAnswer, errors.Errorf("query %s %s from %s: empty answer", d.name, d.qtype, d.server))
+	}
+	for _, expect := range d.expect {
+		if !answers[expect] {
+			return failure(ReasonAnswer, errors.Errorf("query %s %s from %s: answer does not contain %s", d.name, d.qtype, d.server, expect))
+		}
+	}
+	return nil
+}
+
+// normalize - 统一应答格式, 域名转小写并补全末尾的点
+func (d *DNSChecker) normalize(value string) string {
+	switch d.qtype {
+	case dnsmessage.TypeA, dnsmessage.TypeAAAA:
+		if ip := net.ParseIP(value); ip != nil {
+			return ip.String()
+		}
+	case dnsmessage.TypeCNAME:
+		return strings.ToLower(fqdn(value))
+	}
+	return value
+}
+
+func answerValue(body dnsmessage.ResourceBody) (string, bool) {
+	switch record := body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(record.A[:]).String(), true
+	case *dnsmessage.AAAAResource:
+		return net.IP(record.AAAA[:]).String(), true
+	case *dnsmessage.CNAMEResource:
+		return record.CNAME.String(), true
+	case *dnsmessage.TXTResource:
+		return strings.Join(record.TXT, ""), true
+	}
+	return "", false
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
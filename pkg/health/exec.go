@@ -0,0 +1,162 @@
+package health
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"keep-vip/pkg/zlog"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultMaxOutput - 默认最多保留4KB输出
+const defaultMaxOutput = 4096
+
+// ExecOptions - 脚本检查配置
+type ExecOptions struct {
+	Name      string   // 检查名称, 用于日志
+	Command   string   // 可执行文件
+	Args      []string // 参数
+	Env       []string // 追加的环境变量, KEY=VALUE
+	Dir       string   // 工作目录
+	MaxOutput int      // 最多保留的输出字节数, 默认4096
+	Timeout   int      // 单位s
+}
+
+// ExecChecker - 执行命令, 退出码为0健康, 其他不健康. 超时杀死整个进程组
+type ExecChecker struct {
+	name      string
+	command   string
+	args      []string
+	env       []string
+	dir       string
+	maxOutput int
+	timeout   time.Duration
+}
+
+// NewExecChecker - 校验配置并创建脚本检查
+func NewExecChecker(o ExecOptions) (*ExecChecker, error) {
+	if o.Command == "" {
+		return nil, errors.New("exec command cannot be blank")
+	}
+	if _, err := exec.LookPath(o.Command); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	e := &ExecChecker{
+		name:      o.Name,
+		command:   o.Command,
+		args:      o.Args,
+		env:       os.Environ(),
+		dir:       o.Dir,
+		maxOutput: o.MaxOutput,
+		timeout:   Timeout(o.Timeout),
+	}
+	if e.maxOutput <= 0 {
+		e.maxOutput = defaultMaxOutput
+	}
+	for _, env := range o.Env {
+		if !strings.Contains(env, "=") {
+			return nil, errors.Errorf("invalid exec env %q, expected KEY=VALUE", env)
+		}
+		e.env = append(e.env, env)
+	}
+	return e, nil
+}
+
+// Check - 执行命令并等待退出
+func (e *ExecChecker) Check() error {
+	output := &limitedBuffer{limit: e.maxOutput}
+	// 使用自己的管道读取输出: 调用setsid的后代进程不在进程组中, 杀不掉且可能一直持有管道,
+	// 由exec创建的管道会让Wait一直等待. 关闭读端后不再等待
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return failure(ReasonError, errors.WithStack(err))
+	}
+	defer reader.Close()
+	cmd := exec.Command(e.command, e.args...)
+	cmd.Env = e.env
+	cmd.Dir = e.dir
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	// 独立进程组, 超时杀死脚本及其子进程
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err = cmd.Start()
+	writer.Close()
+	if err != nil {
+		return failure(ReasonError, errors.WithStack(err))
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(output, reader)
+		close(copied)
+	}()
+	// stopCopy - 关闭读端并等待输出读取结束
+	stopCopy := func() {
+		reader.Close()
+		<-copied
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(e.timeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-done:
+		// 脚本已退出, 后代进程仍持有管道时最多等到超时
+		select {
+		case <-copied:
+		case <-timer.C:
+		}
+		stopCopy()
+	case <-timer.C:
+		if killErr := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); killErr != nil {
+			zlog.Warn(fmt.Sprintf("Check %s kill process group %d failed: %s", e.name, cmd.Process.Pid, killErr))
+		}
+		<-done
+		stopCopy()
+		return failure(ReasonTimeout, errors.Errorf("%s timed out after %s, output: %s", e.command, e.timeout, output))
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return failure(ReasonExit, errors.Errorf("%s exited with code %d, output: %s", e.command, exitErr.ExitCode(), output))
+		}
+		return failure(ReasonError, errors.WithStack(err))
+	}
+	zlog.Debug(fmt.Sprintf("Check %s command %s succeeded, output: %s", e.name, e.command, output))
+	return nil
+}
+
+// limitedBuffer - 超过limit的输出被丢弃
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if remain := l.limit - l.buf.Len(); remain < len(p) {
+		l.truncated = true
+		if remain > 0 {
+			l.buf.Write(p[:remain])
+		}
+		return len(p), nil
+	}
+	return l.buf.Write(p)
+}
+
+func (l *limitedBuffer) String() string {
+	output := strings.TrimSpace(l.buf.String())
+	if l.truncated {
+		output += "...(truncated)"
+	}
+	return output
+}
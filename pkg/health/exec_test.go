@@ -0,0 +1,67 @@
+package health
+
+import (
+	"keep-vip/pkg/zlog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	zlog.NewZapLog("error", "console")
+	os.Exit(m.Run())
+}
+
+func TestExecCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		timeout int
+		reason  string // 为空时期望成功
+		within  time.Duration
+	}{
+		{name: "success", script: "echo ok", within: 500 * time.Millisecond},
+		{name: "exit code", script: "exit 3", reason: ReasonExit, within: 500 * time.Millisecond},
+		{name: "timeout", script: "sleep 30", reason: ReasonTimeout, within: 1500 * time.Millisecond},
+		// setsid的后代进程不在进程组中, 杀死进程组后仍持有输出管道
+		{name: "timeout with setsid descendant", script: "setsid sleep 30 & sleep 30", reason: ReasonTimeout, within: 1500 * time.Millisecond},
+		{name: "exit with setsid descendant", script: "setsid sleep 30 & echo ok", timeout: 1, within: 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, err := NewExecChecker(ExecOptions{Name: tt.name, Command: "sh", Args: []string{"-c", tt.script}, Timeout: tt.timeout})
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			err = checker.Check()
+			if elapsed := time.Since(start); elapsed > tt.within {
+				t.Fatalf("Check returned after %s, want within %s", elapsed, tt.within)
+			}
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("Check = %v, want success", err)
+				}
+				return
+			}
+			if err == nil || Reason(err) != tt.reason {
+				t.Fatalf("Check = %v, want reason %s", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestExecOutputLimit(t *testing.T) {
+	checker, err := NewExecChecker(ExecOptions{Command: "sh", Args: []string{"-c", "echo 0123456789; exit 1"}, MaxOutput: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = checker.Check()
+	if err == nil || Reason(err) != ReasonExit {
+		t.Fatalf("Check = %v, want exit failure", err)
+	}
+	if want := "output: 0123...(truncated)"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("Check = %v, want %q", err, want)
+	}
+}
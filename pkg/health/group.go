@@ -0,0 +1,75 @@
+package health
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+// 组合方式
+const (
+	CombineAll    = "all"    // 全部passing为passing, 任意failing为failing
+	CombineAny    = "any"    // 任意passing为passing, 全部failing为failing
+	CombineQuorum = "quorum" // 至少n个passing为passing, 不可能达到n个时为failing
+)
+
+// Combinator - 检查组的组合方式
+type Combinator struct {
+	Kind   string
+	Quorum int // kind为quorum时有效
+}
+
+// ParseCombinator - 解析组合方式: all|any|quorum(n), 为空时为all
+func ParseCombinator(mode string) (Combinator, error) {
+	mode = strings.ToLower(strings.ReplaceAll(mode, " ", ""))
+	switch {
+	case mode == "" || mode == CombineAll:
+		return Combinator{Kind: CombineAll}, nil
+	case mode == CombineAny:
+		return Combinator{Kind: CombineAny}, nil
+	case strings.HasPrefix(mode, CombineQuorum+"(") && strings.HasSuffix(mode, ")"):
+		n, err := strconv.Atoi(mode[len(CombineQuorum)+1 : len(mode)-1])
+		if err != nil || n <= 0 {
+			return Combinator{}, errors.Errorf("invalid quorum: %s", mode)
+		}
+		return Combinator{Kind: CombineQuorum, Quorum: n}, nil
+	default:
+		return Combinator{}, errors.Errorf("unsupported combinator: %s", mode)
+	}
+}
+
+func (c Combinator) String() string {
+	if c.Kind == CombineQuorum {
+		return fmt.Sprintf("%s(%d)", c.Kind, c.Quorum)
+	}
+	return c.Kind
+}
+
+// Combine - 根据成员状态计算组状态, 无法确定时为unknown
+func (c Combinator) Combine(states []State) State {
+	var passing, failing int
+	for _, state := range states {
+		switch state {
+		case StatePassing:
+			passing++
+		case StateFailing:
+			failing++
+		}
+	}
+	need := len(states)
+	switch c.Kind {
+	case CombineAny:
+		need = 1
+	case CombineQuorum:
+		need = c.Quorum
+	}
+	switch {
+	case passing >= need:
+		return StatePassing
+	case len(states)-failing < need:
+		return StateFailing
+	default:
+		return StateUnknown
+	}
+}
@@ -0,0 +1,74 @@
+package health
+
+import "testing"
+
+func TestParseCombinator(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    Combinator
+		wantErr bool
+	}{
+		{mode: "", want: Combinator{Kind: CombineAll}},
+		{mode: "all", want: Combinator{Kind: CombineAll}},
+		{mode: "ANY", want: Combinator{Kind: CombineAny}},
+		{mode: "quorum(2)", want: Combinator{Kind: CombineQuorum, Quorum: 2}},
+		{mode: "quorum( 3 )", want: Combinator{Kind: CombineQuorum, Quorum: 3}},
+		{mode: "quorum(0)", wantErr: true},
+		{mode: "quorum(-1)", wantErr: true},
+		{mode: "quorum(x)", wantErr: true},
+		{mode: "quorum2", wantErr: true},
+		{mode: "most", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCombinator(tt.mode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCombinator(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseCombinator(%q) = %+v, want %+v", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestCombinatorString(t *testing.T) {
+	if got := (Combinator{Kind: CombineQuorum, Quorum: 2}).String(); got != "quorum(2)" {
+		t.Errorf("String() = %s, want quorum(2)", got)
+	}
+	if got := (Combinator{Kind: CombineAny}).String(); got != "any" {
+		t.Errorf("String() = %s, want any", got)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	const (
+		p = StatePassing
+		f = StateFailing
+		u = StateUnknown
+	)
+	all := Combinator{Kind: CombineAll}
+	anyOf := Combinator{Kind: CombineAny}
+	quorum2 := Combinator{Kind: CombineQuorum, Quorum: 2}
+	tests := []struct {
+		name       string
+		combinator Combinator
+		states     []State
+		want       State
+	}{
+		{"all passing", all, []State{p, p, p}, p},
+		{"all one failing", all, []State{p, f, p}, f},
+		{"all one unknown", all, []State{p, u, p}, u},
+		{"any one passing", anyOf, []State{f, p, f}, p},
+		{"any all failing", anyOf, []State{f, f, f}, f},
+		{"any unknown", anyOf, []State{f, u, f}, u},
+		{"quorum reached", quorum2, []State{p, f, p}, p},
+		{"quorum impossible", quorum2, []State{p, f, f}, f},
+		{"quorum undecided", quorum2, []State{p, u, f}, u},
+		{"quorum larger than group", Combinator{Kind: CombineQuorum, Quorum: 4}, []State{p, p, p}, f},
+	}
+	for _, tt := range tests {
+		if got := tt.combinator.Combine(tt.states); got != tt.want {
+			t.Errorf("%s: Combine(%v) = %s, want %s", tt.name, tt.states, got, tt.want)
+		}
+	}
+}
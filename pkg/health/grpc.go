@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"net"
+	"time"
+)
+
+// GRPCOptions - gRPC健康检查配置, 使用grpc.health.v1.Health协议
+type GRPCOptions struct {
+	Address   string // host:port
+	Service   string // 服务名, 为空检查整个服务端
+	TLS       bool   // 使用TLS连接
+	TLSConfig TLSOptions
+	Timeout   int // 单位s, 连接和请求的总超时时间
+}
+
+// GRPCChecker - 调用Health/Check, SERVING为健康
+type GRPCChecker struct {
+	address     string
+	service     string
+	credentials credentials.TransportCredentials
+	timeout     time.Duration
+}
+
+// NewGRPCChecker - 校验配置并创建gRPC检查
+func NewGRPCChecker(o GRPCOptions) (*GRPCChecker, error) {
+	if _, _, err := net.SplitHostPort(o.Address); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	g := &GRPCChecker{
+		address:     o.Address,
+		service:     o.Service,
+		credentials: insecure.NewCredentials(),
+		timeout:     Timeout(o.Timeout),
+	}
+	if o.TLS {
+		tlsConfig, err := o.TLSConfig.Config()
+		if err != nil {
+			return nil, err
+		}
+		g.credentials = credentials.NewTLS(tlsConfig)
+	}
+	return g, nil
+}
+
+// Check - 建立连接并调用Health/Check
+func (g *GRPCChecker) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, g.address,
+		grpc.WithTransportCredentials(g.credentials),
+		grpc.WithBlock(),
+		grpc.WithReturnConnectionError(),
+	)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return failure(ReasonTimeout, errors.Wrapf(err, "dial %s", g.address))
+		}
+		return failure(requestReason(err), errors.Wrapf(err, "dial %s", g.address))
+	}
+	defer conn.Close()
+
+	response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: g.service})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.DeadlineExceeded:
+			return failure(ReasonTimeout, errors.Wrapf(err, "check %s service '%s'", g.address, g.service))
+		case codes.Unimplemented, codes.NotFound:
+			return failure(ReasonStatus, errors.Wrapf(err, "check %s service '%s'", g.address, g.service))
+		default:
+			return failure(ReasonConnect, errors.Wrapf(err, "check %s service '%s'", g.address, g.service))
+		}
+	}
+	if response.Status != healthpb.HealthCheckResponse_SERVING {
+		return failure(ReasonStatus, errors.Errorf("check %s service '%s' status: %s", g.address, g.service, response.Status))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package health
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// 检查失败原因, 用于日志和监控标签
+const (
+	ReasonConnect = "connect" // 连接失败
+	ReasonTimeout = "timeout" // 超时
+	ReasonStatus  = "status"  // 状态码不符合预期
+	ReasonBody    = "body"    // 响应内容不符合预期
+	ReasonTLS     = "tls"     // TLS握手或证书校验失败
+	ReasonExit    = "exit"    // 脚本退出码不为0
+	ReasonAnswer  = "answer"  // DNS应答不符合预期
+	ReasonLoss    = "loss"    // ICMP丢包率超过阈值
+	ReasonLatency = "latency" // ICMP延迟超过阈值
+	ReasonRole    = "role"    // 数据库角色不符合预期
+	ReasonExpiry  = "expiry"  // 证书过期或者即将过期
+	ReasonError   = "error"   // 其他错误
+)
+
+// Checker - 健康检查, 返回nil为健康
+type Checker interface {
+	Check() error
+}
+
+// CheckError - 带失败原因的检查错误
+type CheckError struct {
+	Reason string
+	Err    error
+}
+
+func (e *CheckError) Error() string {
+	return e.Reason + ": " + e.Err.Error()
+}
+
+// Cause - 兼容errors.Cause
+func (e *CheckError) Cause() error {
+	return e.Err
+}
+
+// Unwrap - 兼容errors.Is/As
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// failure - 包装检查错误和失败原因
+func failure(reason string, err error) error {
+	return &CheckError{Reason: reason, Err: err}
+}
+
+// Reason - 返回检查错误的失败原因
+func Reason(err error) string {
+	var checkErr *CheckError
+	if errors.As(err, &checkErr) {
+		return checkErr.Reason
+	}
+	return ReasonError
+}
+
+// Timeout - 检查超时时间, 单位s. 低于1秒使用500毫秒
+func Timeout(timeout int) time.Duration {
+	if timeout <= 0 {
+		return time.Millisecond * 500
+	}
+	return time.Second * time.Duration(timeout)
+}
+
+// randomID - 使用crypto/rand生成16位ID, 避免每次启动的序列相同
+func randomID() (uint16, error) {
+	var random [2]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return binary.BigEndian.Uint16(random[:]), nil
+}
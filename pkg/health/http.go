@@ -0,0 +1,208 @@
+package health
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxBodySize - 匹配响应内容时最多读取64KB
+const maxBodySize = 64 * 1024
+
+// HTTPOptions - HTTP/HTTPS检查配置
+type HTTPOptions struct {
+	Address      string            // host:port
+	HTTPS        bool              // 使用https
+	Method       string            // 默认GET
+	Path         string            // 默认/
+	Host         string            // Host请求头, 为空使用address
+	Headers      map[string]string // 请求头
+	ExpectStatus []string          // 期望的状态码, 例如: 200, 200-299, 3xx. 默认200-399
+	BodyContains string            // 响应内容包含的字符串
+	BodyRegex    string            // 响应内容匹配的正则表达式
+	TLS          TLSOptions
+	Timeout      int // 单位s
+}
+
+// statusRange - 状态码范围
+type statusRange struct {
+	min, max int
+}
+
+// HTTPChecker - HTTP/HTTPS检查, 不跟随重定向
+type HTTPChecker struct {
+	url          string
+	method       string
+	host         string
+	headers      map[string]string
+	status       []statusRange
+	bodyContains string
+	bodyRegex    *regexp.Regexp
+	client       *http.Client
+}
+
+// NewHTTPChecker - 校验配置并创建HTTP检查
+func NewHTTPChecker(o HTTPOptions) (*HTTPChecker, error) {
+	scheme := "http"
+	if o.HTTPS {
+		scheme = "https"
+	}
+	if _, _, err := net.SplitHostPort(o.Address); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	path := o.Path
+	if path == "" {
+		path = "/"
+	} else if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	method := strings.ToUpper(o.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	h := &HTTPChecker{
+		url:          fmt.Sprintf("%s://%s%s", scheme, o.Address, path),
+		method:       method,
+		host:         o.Host,
+		headers:      o.Headers,
+		bodyContains: o.BodyContains,
+	}
+	if len(o.ExpectStatus) == 0 {
+		h.status = []statusRange{{min: 200, max: 399}}
+	}
+	for _, expect := range o.ExpectStatus {
+		status, err := parseStatusRange(expect)
+		if err != nil {
+			return nil, err
+		}
+		h.status = append(h.status, status)
+	}
+	if o.BodyRegex != "" {
+		regex, err := regexp.Compile(o.BodyRegex)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		h.bodyRegex = regex
+	}
+
+	transport := &http.Transport{
+		Proxy:             nil,
+		DisableKeepAlives: true,
+	}
+	if o.HTTPS {
+		tlsConfig, err := o.TLS.Config()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	h.client = &http.Client{
+		Transport: transport,
+		Timeout:   Timeout(o.Timeout),
+		// 不跟随重定向, 由期望状态码判断
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return h, nil
+}
+
+// Check - 发送请求, 校验状态码和响应内容
+func (h *HTTPChecker) Check() error {
+	request, err := http.NewRequest(h.method, h.url, nil)
+	if err != nil {
+		return failure(ReasonError, errors.WithStack(err))
+	}
+	for key, value := range h.headers {
+		request.Header.Set(key, value)
+	}
+	if h.host != "" {
+		request.Host = h.host
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return failure(requestReason(err), errors.WithStack(err))
+	}
+	defer response.Body.Close()
+
+	if !h.expectStatus(response.StatusCode) {
+		return failure(ReasonStatus, errors.Errorf("%s %s unexpected status: %s", h.method, h.url, response.Status))
+	}
+	if h.bodyContains == "" && h.bodyRegex == nil {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxBodySize))
+	if err != nil {
+		return failure(requestReason(err), errors.WithStack(err))
+	}
+	if h.bodyContains != "" && !strings.Contains(string(body), h.bodyContains) {
+		return failure(ReasonBody, errors.Errorf("%s %s response body does not contain %q", h.method, h.url, h.bodyContains))
+	}
+	if h.bodyRegex != nil && !h.bodyRegex.Match(body) {
+		return failure(ReasonBody, errors.Errorf("%s %s response body does not match %q", h.method, h.url, h.bodyRegex.String()))
+	}
+	return nil
+}
+
+func (h *HTTPChecker) expectStatus(code int) bool {
+	for _, status := range h.status {
+		if code >= status.min && code <= status.max {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusRange - 解析状态码: 200, 200-299, 2xx
+func parseStatusRange(expect string) (statusRange, error) {
+	expect = strings.ToLower(strings.TrimSpace(expect))
+	if len(expect) == 3 && strings.HasSuffix(expect, "xx") {
+		class, err := strconv.Atoi(expect[:1])
+		if err == nil && class >= 1 && class <= 5 {
+			return statusRange{min: class * 100, max: class*100 + 99}, nil
+		}
+	}
+	bounds := strings.SplitN(expect, "-", 2)
+	min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return statusRange{}, errors.Errorf("invalid expect status: %s", expect)
+	}
+	max := min
+	if len(bounds) == 2 {
+		if max, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil || max < min {
+			return statusRange{}, errors.Errorf("invalid expect status: %s", expect)
+		}
+	}
+	// HTTP状态码范围100-599
+	if min < 100 || max > 599 {
+		return statusRange{}, errors.Errorf("expect status out of range 100-599: %s", expect)
+	}
+	return statusRange{min: min, max: max}, nil
+}
+
+// requestReason - 根据请求错误判断失败原因
+func requestReason(err error) string {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ReasonTimeout
+	}
+	var (
+		recordErr   tls.RecordHeaderError
+		unknownErr  x509.UnknownAuthorityError
+		hostnameErr x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+	)
+	if errors.As(err, &recordErr) || errors.As(err, &unknownErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) {
+		return ReasonTLS
+	}
+	return ReasonConnect
+}
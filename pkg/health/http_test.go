@@ -0,0 +1,38 @@
+package health
+
+import "testing"
+
+func TestParseStatusRange(t *testing.T) {
+	tests := []struct {
+		expect  string
+		want    statusRange
+		wantErr bool
+	}{
+		{expect: "200", want: statusRange{min: 200, max: 200}},
+		{expect: " 204 ", want: statusRange{min: 204, max: 204}},
+		{expect: "200-299", want: statusRange{min: 200, max: 299}},
+		{expect: "200 - 204", want: statusRange{min: 200, max: 204}},
+		{expect: "2xx", want: statusRange{min: 200, max: 299}},
+		{expect: "5XX", want: statusRange{min: 500, max: 599}},
+		{expect: "6xx", wantErr: true},
+		{expect: "299-200", wantErr: true},
+		{expect: "abc", wantErr: true},
+		{expect: "200-abc", wantErr: true},
+		{expect: "", wantErr: true},
+		{expect: "42", wantErr: true},
+		{expect: "0-9999", wantErr: true},
+		{expect: "100-599", want: statusRange{min: 100, max: 599}},
+		{expect: "99-200", wantErr: true},
+		{expect: "200-600", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseStatusRange(tt.expect)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStatusRange(%q) error = %v, wantErr %v", tt.expect, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseStatusRange(%q) = %+v, want %+v", tt.expect, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"net"
+	"time"
+)
+
+// protocolICMP - IANA ICMP协议号
+const protocolICMP = 1
+
+// ICMPOptions - ICMP检查配置
+type ICMPOptions struct {
+	Address string // 主机名或IP地址
+	Count   int    // 发送次数, 默认3
+	MaxLoss int    // 最大丢包率(%), 超过则失败, 默认0
+	MaxRtt  int    // 最大平均延迟(ms), 超过则失败, 0不限制
+	Timeout int    // 单位s, 所有报文的总超时时间
+}
+
+// ICMPChecker - 发送ICMP Echo, 按丢包率和平均延迟判断健康, 需要root权限
+type ICMPChecker struct {
+	address string
+	count   int
+	maxLoss int
+	maxRtt  time.Duration
+	timeout time.Duration
+	id      int
+}
+
+// NewICMPChecker - 校验配置并创建ICMP检查
+func NewICMPChecker(o ICMPOptions) (*ICMPChecker, error) {
+	if o.Address == "" {
+		return nil, errors.New("icmp address cannot be blank")
+	}
+	if o.MaxLoss < 0 || o.MaxLoss > 100 {
+		return nil, errors.Errorf("icmp max loss must be between 0 and 100: %d", o.MaxLoss)
+	}
+	// 区分同时运行的多个ICMP检查
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	i := &ICMPChecker{
+		address: o.Address,
+		count:   o.Count,
+		maxLoss: o.MaxLoss,
+		maxRtt:  time.Duration(o.MaxRtt) * time.Millisecond,
+		timeout: Timeout(o.Timeout),
+		id:      int(id),
+	}
+	if i.count <= 0 {
+		i.count = 3
+	}
+	return i, nil
+}
+
+// Check - 依次发送Echo请求, 每个请求最多等待timeout/count
+func (i *ICMPChecker) Check() error {
+	dst, err := net.ResolveIPAddr("ip4", i.address)
+	if err != nil {
+		return failure(ReasonConnect, errors.WithStack(err))
+	}
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return failure(ReasonError, errors.WithStack(err))
+	}
+	defer conn.Close()
+
+	wait := i.timeout / time.Duration(i.count)
+	var received int
+	var total time.Duration
+	for seq := 0; seq < i.count; seq++ {
+		rtt, ok, err := i.ping(conn, dst, seq, wait)
+		if err != nil {
+			return failure(ReasonError, err)
+		}
+		if ok {
+			received++
+			total += rtt
+		}
+	}
+
+	if received == 0 {
+		return failure(ReasonTimeout, errors.Errorf("ping %s: 100%% packet loss", i.address))
+	}
+	loss := (i.count - received) * 100 / i.count
+	avg := total / time.Duration(received)
+	if loss > i.maxLoss {
+		return failure(ReasonLoss, errors.Errorf("ping %s: %d%% packet loss, max %d%%", i.address, loss, i.maxLoss))
+	}
+	if i.maxRtt > 0 && avg > i.maxRtt {
+		return failure(ReasonLatency, errors.Errorf("ping %s: avg rtt %s, max %s", i.address, avg, i.maxRtt))
+	}
+	return nil
+}
+
+// ping - 发送一个Echo请求, 等待匹配的Echo应答
+func (i *ICMPChecker) ping(conn *icmp.PacketConn, dst *net.IPAddr, seq int, wait time.Duration) (time.Duration, bool, error) {
+	message := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Code: 0,
+		Body: &icmp.Echo{ID: i.id, Seq: seq, Data: []byte("keep-vip")},
+	}
+	packet, err := message.Marshal(nil)
+	if err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+	start := time.Now()
+	if _, err := conn.WriteTo(packet, dst); err != nil {
+		return 0, false, errors.Wrapf(err, "ping %s", i.address)
+	}
+	if err := conn.SetReadDeadline(start.Add(wait)); err != nil {
+		return 0, false, errors.WithStack(err)
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0, false, nil
+			}
+			return 0, false, errors.WithStack(err)
+		}
+		reply, err := icmp.ParseMessage(protocolICMP, buf[:n])
+		if err != nil || reply.Type != ipv4.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.ID != i.id || echo.Seq != seq || peer.String() != dst.String() {
+			continue
+		}
+		return time.Since(start), true, nil
+	}
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// 手动覆盖方式
+const (
+	OverridePause = "pause" // 暂停检查, 状态为unknown
+	OverridePass  = "pass"  // 暂停检查, 状态为passing
+	OverrideFail  = "fail"  // 暂停检查, 状态为failing
+)
+
+// Override - 检查的手动覆盖, 过期后自动恢复
+type Override struct {
+	Name    string    `json:"name"`
+	Mode    string    `json:"mode"`
+	Reason  string    `json:"reason,omitempty"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// State - 覆盖后的检查状态
+func (o Override) State() State {
+	switch o.Mode {
+	case OverridePass:
+		return StatePassing
+	case OverrideFail:
+		return StateFailing
+	default:
+		return StateUnknown
+	}
+}
+
+// active - 覆盖是否还未过期
+func (o *Override) active(now time.Time) bool {
+	return o != nil && now.Before(o.Expires)
+}
+
+// NewOverride - 校验并创建覆盖
+func NewOverride(name, mode string, ttl time.Duration, reason string) (Override, error) {
+	mode = strings.ToLower(mode)
+	switch mode {
+	case OverridePause, OverridePass, OverrideFail:
+	default:
+		return Override{}, errors.Errorf("unsupported override mode: %s", mode)
+	}
+	if ttl <= 0 {
+		return Override{}, errors.New("override ttl must be greater than 0")
+	}
+	now := time.Now()
+	return Override{
+		Name:    name,
+		Mode:    mode,
+		Reason:  reason,
+		Created: now,
+		Expires: now.Add(ttl),
+	}, nil
+}
@@ -0,0 +1,148 @@
+package health
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingChecker - 记录执行次数, 返回err
+type countingChecker struct {
+	calls int32
+	err   error
+}
+
+func (c *countingChecker) Check() error {
+	atomic.AddInt32(&c.calls, 1)
+	return c.err
+}
+
+func newOverrideScheduler(checker Checker) *Scheduler {
+	return NewScheduler([]*Job{{Name: "web", Checker: checker, Interval: time.Second, Tracker: NewTracker(1, 1, 0)}}, nil)
+}
+
+func TestNewOverride(t *testing.T) {
+	tests := []struct {
+		mode    string
+		ttl     time.Duration
+		want    State
+		wantErr bool
+	}{
+		{mode: "pass", ttl: time.Minute, want: StatePassing},
+		{mode: "FAIL", ttl: time.Minute, want: StateFailing},
+		{mode: "pause", ttl: time.Minute, want: StateUnknown},
+		{mode: "skip", ttl: time.Minute, wantErr: true},
+		{mode: "pass", ttl: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		override, err := NewOverride("web", tt.mode, tt.ttl, "")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewOverride(%s, %s) error = %v, wantErr %v", tt.mode, tt.ttl, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := override.State(); got != tt.want {
+			t.Errorf("NewOverride(%s) state = %s, want %s", tt.mode, got, tt.want)
+		}
+		// 覆盖的状态优先于检查结果
+		scheduler := newOverrideScheduler(&countingChecker{})
+		scheduler.execute(scheduler.jobs[0])
+		if err := scheduler.SetOverride(override); err != nil {
+			t.Fatal(err)
+		}
+		if got := scheduler.Store().State("web"); got != tt.want {
+			t.Errorf("store state with %s override = %s, want %s", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestOverrideSkipsCheck(t *testing.T) {
+	checker := &countingChecker{err: errCheck}
+	scheduler := newOverrideScheduler(checker)
+	override, err := NewOverride("web", OverridePass, time.Minute, "maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.SetOverride(override); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		scheduler.execute(scheduler.jobs[0])
+	}
+	if calls := atomic.LoadInt32(&checker.calls); calls != 0 {
+		t.Fatalf("checker called %d times while overridden", calls)
+	}
+	if state := scheduler.Store().State("web"); state != StatePassing {
+		t.Fatalf("state = %s, want passing", state)
+	}
+	if status, _ := scheduler.Store().Status("web"); status.Override == nil || status.State != "passing" {
+		t.Fatalf("status = %+v, want passing override", status)
+	}
+}
+
+func TestOverrideExpires(t *testing.T) {
+	checker := &countingChecker{err: errCheck}
+	scheduler := newOverrideScheduler(checker)
+	scheduler.execute(scheduler.jobs[0])
+	override, err := NewOverride("web", OverridePass, 50*time.Millisecond, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.SetOverride(override); err != nil {
+		t.Fatal(err)
+	}
+	<-scheduler.Changes()
+	if state := scheduler.Store().State("web"); state != StatePassing {
+		t.Fatalf("state = %s, want passing", state)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	// 过期后不再生效, 恢复检查的真实状态
+	if state := scheduler.Store().State("web"); state != StateFailing {
+		t.Fatalf("state after expiry = %s, want failing", state)
+	}
+	if overrides := scheduler.Store().Overrides(); len(overrides) != 0 {
+		t.Fatalf("overrides after expiry = %v, want none", overrides)
+	}
+	scheduler.execute(scheduler.jobs[0])
+	if calls := atomic.LoadInt32(&checker.calls); calls != 2 {
+		t.Fatalf("checker called %d times, want 2", calls)
+	}
+	// 过期的覆盖被删除并通知状态变化
+	select {
+	case <-scheduler.Changes():
+	default:
+		t.Fatal("no change notification after the override expired")
+	}
+	if scheduler.ClearOverride("web") {
+		t.Fatal("ClearOverride returned true for an expired override")
+	}
+}
+
+func TestClearOverride(t *testing.T) {
+	scheduler := newOverrideScheduler(&countingChecker{})
+	if scheduler.ClearOverride("web") {
+		t.Fatal("ClearOverride returned true without an override")
+	}
+	if scheduler.ClearOverride("missing") {
+		t.Fatal("ClearOverride returned true for an unknown check")
+	}
+	if err := scheduler.SetOverride(Override{Name: "missing", Mode: OverridePass, Expires: time.Now().Add(time.Minute)}); err == nil {
+		t.Fatal("SetOverride accepted an unknown check")
+	}
+	override, err := NewOverride("web", OverrideFail, time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.SetOverride(override); err != nil {
+		t.Fatal(err)
+	}
+	if !scheduler.ClearOverride("web") {
+		t.Fatal("ClearOverride returned false for an active override")
+	}
+	if state := scheduler.Store().State("web"); state != StateUnknown {
+		t.Fatalf("state after clear = %s, want unknown", state)
+	}
+}
@@ -0,0 +1,151 @@
+package health
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisChecker - 发送ROLE命令, master为主库, slave为从库
+type RedisChecker struct {
+	address  string
+	user     string
+	password string
+	role     string
+	timeout  time.Duration
+}
+
+// NewRedisChecker - 校验配置并创建Redis角色检查, user为空时使用AUTH password
+func NewRedisChecker(o DatabaseOptions) (*RedisChecker, error) {
+	if _, _, err := net.SplitHostPort(o.Address); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	role, err := o.role()
+	if err != nil {
+		return nil, err
+	}
+	return &RedisChecker{
+		address:  o.Address,
+		user:     o.User,
+		password: o.Password,
+		role:     role,
+		timeout:  Timeout(o.Timeout),
+	}, nil
+}
+
+// Check - 建立连接, 认证后查询角色
+func (r *RedisChecker) Check() error {
+	conn, err := net.DialTimeout("tcp", r.address, r.timeout)
+	if err != nil {
+		if isTimeout(err) {
+			return failure(ReasonTimeout, errors.Wrapf(err, "dial %s", r.address))
+		}
+		return failure(ReasonConnect, errors.Wrapf(err, "dial %s", r.address))
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(r.timeout)); err != nil {
+		return failure(ReasonError, errors.WithStack(err))
+	}
+
+	reader := bufio.NewReader(conn)
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.user != "" {
+			args = []string{"AUTH", r.user, r.password}
+		}
+		if _, err := redisCommand(conn, reader, args...); err != nil {
+			return r.failure(err, "auth")
+		}
+	}
+	role, err := redisCommand(conn, reader, "ROLE")
+	if err != nil {
+		return r.failure(err, "role")
+	}
+	switch role {
+	case "master":
+		return checkRole(r.address, r.role, true)
+	case "slave":
+		return checkRole(r.address, r.role, false)
+	default:
+		return failure(ReasonRole, errors.Errorf("%s role is %s, expect %s", r.address, role, r.role))
+	}
+}
+
+func (r *RedisChecker) failure(err error, command string) error {
+	if isTimeout(err) {
+		return failure(ReasonTimeout, errors.Wrapf(err, "redis %s %s", r.address, command))
+	}
+	return failure(ReasonConnect, errors.Wrapf(err, "redis %s %s", r.address, command))
+}
+
+// redisCommand - 发送RESP命令, 返回简单字符串、批量字符串或者数组的第一个元素
+func redisCommand(conn net.Conn, reader *bufio.Reader, args ...string) (string, error) {
+	var request strings.Builder
+	fmt.Fprintf(&request, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&request, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(conn, request.String()); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	line, err := redisLine(reader)
+	if err != nil {
+		return "", err
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return "", errors.Errorf("redis error: %s", line[1:])
+	case '$':
+		return redisBulk(reader, line)
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n <= 0 {
+			return "", errors.Errorf("unexpected redis reply: %s", line)
+		}
+		// ROLE返回数组, 第一个元素是角色, 其余元素不需要读取
+		first, err := redisLine(reader)
+		if err != nil {
+			return "", err
+		}
+		if first[0] != '$' {
+			return "", errors.Errorf("unexpected redis reply: %s", first)
+		}
+		return redisBulk(reader, first)
+	default:
+		return "", errors.Errorf("unexpected redis reply: %s", line)
+	}
+}
+
+// redisLine - 读取一行回复, 去掉\r\n
+func redisLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty redis reply")
+	}
+	return line, nil
+}
+
+// redisBulk - 读取批量字符串的内容
+func redisBulk(reader *bufio.Reader, header string) (string, error) {
+	n, err := strconv.Atoi(header[1:])
+	if err != nil || n < 0 {
+		return "", errors.Errorf("unexpected redis reply: %s", header)
+	}
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(data[:n]), nil
+}
@@ -0,0 +1,124 @@
+package health
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedisCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		reply   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "master",
+			args:  []string{"ROLE"},
+			reply: "*3\r\n$6\r\nmaster\r\n:3129659\r\n*1\r\n*3\r\n$9\r\n127.0.0.1\r\n$4\r\n9001\r\n$7\r\n3129242\r\n",
+			want:  "master",
+		},
+		{
+			name:  "slave",
+			args:  []string{"ROLE"},
+			reply: "*5\r\n$5\r\nslave\r\n$9\r\n127.0.0.1\r\n:9000\r\n$9\r\nconnected\r\n:3167038\r\n",
+			want:  "slave",
+		},
+		{
+			name:  "sentinel",
+			args:  []string{"ROLE"},
+			reply: "*2\r\n$8\r\nsentinel\r\n*1\r\n$8\r\nmymaster\r\n",
+			want:  "sentinel",
+		},
+		{
+			name:  "simple string",
+			args:  []string{"AUTH", "secret"},
+			reply: "+OK\r\n",
+			want:  "OK",
+		},
+		{
+			name:    "noauth",
+			args:    []string{"ROLE"},
+			reply:   "-NOAUTH Authentication required.\r\n",
+			wantErr: "NOAUTH Authentication required.",
+		},
+		{
+			name:    "empty array",
+			args:    []string{"ROLE"},
+			reply:   "*0\r\n",
+			wantErr: "unexpected redis reply",
+		},
+		{
+			name:    "integer",
+			args:    []string{"ROLE"},
+			reply:   ":1\r\n",
+			wantErr: "unexpected redis reply",
+		},
+		{
+			name:    "truncated bulk",
+			args:    []string{"ROLE"},
+			reply:   "*1\r\n$6\r\nmas",
+			wantErr: "EOF",
+		},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		requests := make(chan string, 1)
+		go func(reply string) {
+			defer server.Close()
+			request, err := readRedisRequest(bufio.NewReader(server))
+			if err != nil {
+				requests <- ""
+				return
+			}
+			requests <- request
+			_, _ = io.WriteString(server, reply)
+		}(tt.reply)
+		_ = client.SetDeadline(time.Now().Add(time.Second))
+		got, err := redisCommand(client, bufio.NewReader(client), tt.args...)
+		client.Close()
+		if request := <-requests; request != strings.Join(tt.args, " ") {
+			t.Errorf("%s: server received %q, want %q", tt.name, request, strings.Join(tt.args, " "))
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: redisCommand = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// readRedisRequest - 解析RESP数组格式的请求, 参数以空格连接
+func readRedisRequest(reader *bufio.Reader) (string, error) {
+	header, err := redisLine(reader)
+	if err != nil {
+		return "", err
+	}
+	var n int
+	if _, err := fmt.Sscanf(header, "*%d", &n); err != nil {
+		return "", err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		bulk, err := redisLine(reader)
+		if err != nil {
+			return "", err
+		}
+		arg, err := redisBulk(reader, bulk)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+	}
+	return strings.Join(args, " "), nil
+}
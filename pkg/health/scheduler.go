@@ -0,0 +1,319 @@
+package health
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// Job - 调度的检查
+type Job struct {
+	Name     string
+	Checker  Checker
+	Interval time.Duration
+	Tracker  *Tracker
+	Skip     func() bool // 返回true时跳过本次检查, 状态为unknown. 用于依赖的检查failing时
+}
+
+// Result - 一次检查的结果
+type Result struct {
+	Name     string
+	Err      error
+	State    State
+	Changed  bool // 状态是否发生变化
+	Duration time.Duration
+}
+
+// Scheduler - 每个检查在独立的goroutine中按自己的间隔执行, 同一个检查同时最多执行一次.
+// 检查耗时超过间隔时跳过错过的周期, 不会堆积
+type Scheduler struct {
+	jobs     []*Job
+	store    *Store
+	onResult func(Result)
+	changes  chan struct{}
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewScheduler - onResult在检查goroutine中调用, 用于日志和监控
+func NewScheduler(jobs []*Job, onResult func(Result)) *Scheduler {
+	store := NewStore()
+	for _, job := range jobs {
+		store.register(job.Name, job.Tracker)
+	}
+	return &Scheduler{
+		jobs:     jobs,
+		store:    store,
+		onResult: onResult,
+		changes:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start - 启动所有检查
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.run(job)
+	}
+}
+
+// Stop - 停止调度, 等待执行中的检查结束
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// Store - 返回检查状态存储
+func (s *Scheduler) Store() *Store {
+	return s.store
+}
+
+// Changes - 任意检查状态变化时收到通知
+func (s *Scheduler) Changes() <-chan struct{} {
+	return s.changes
+}
+
+func (s *Scheduler) run(job *Job) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+	for {
+		s.execute(job)
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetOverride - 设置检查的手动覆盖, 立即生效
+func (s *Scheduler) SetOverride(override Override) error {
+	if err := s.store.setOverride(override); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// ClearOverride - 删除检查的手动覆盖, 返回是否存在
+func (s *Scheduler) ClearOverride(name string) bool {
+	if !s.store.clearOverride(name) {
+		return false
+	}
+	s.notify()
+	return true
+}
+
+func (s *Scheduler) execute(job *Job) {
+	// 覆盖过期后恢复检查
+	if s.store.expireOverride(job.Name) {
+		s.notify()
+	}
+	if s.store.Override(job.Name) != nil {
+		return
+	}
+	skip := job.Skip != nil && job.Skip()
+	if s.store.skip(job.Name, skip) {
+		s.notify()
+	}
+	if skip {
+		return
+	}
+	start := time.Now()
+	err := job.Checker.Check()
+	result := s.store.record(job.Name, err, start, time.Since(start))
+	if s.onResult != nil {
+		s.onResult(result)
+	}
+	if result.Changed {
+		s.notify()
+	}
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.changes <- struct{}{}:
+	default:
+	}
+}
+
+// CheckStatus - 检查状态快照
+type CheckStatus struct {
+	Name     string     `json:"name"`
+	LastRun  *time.Time `json:"lastRun,omitempty"`
+	Duration string     `json:"duration,omitempty"`
+	Skipped  bool       `json:"skipped,omitempty"` // 依赖的检查failing, 跳过检查
+	Override *Override  `json:"override,omitempty"`
+	TrackerStatus
+}
+
+// Store - 线程安全的检查状态存储
+type Store struct {
+	mu      sync.RWMutex
+	names   []string
+	entries map[string]*storeEntry
+}
+
+type storeEntry struct {
+	tracker  *Tracker
+	lastRun  time.Time
+	duration time.Duration
+	skipped  bool
+	override *Override
+}
+
+// NewStore - 创建检查状态存储
+func NewStore() *Store {
+	return &Store{entries: make(map[string]*storeEntry)}
+}
+
+func (s *Store) register(name string, tracker *Tracker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.names = append(s.names, name)
+	s.entries[name] = &storeEntry{tracker: tracker}
+}
+
+func (s *Store) record(name string, err error, start time.Time, duration time.Duration) Result {
+	s.mu.Lock()
+	entry := s.entries[name]
+	entry.lastRun = start
+	entry.duration = duration
+	s.mu.Unlock()
+	state, changed := entry.tracker.Record(err)
+	return Result{
+		Name:     name,
+		Err:      err,
+		State:    state,
+		Changed:  changed,
+		Duration: duration,
+	}
+}
+
+// skip - 设置是否跳过检查, 返回是否发生变化
+func (s *Store) skip(name string, skipped bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.entries[name]
+	changed := entry.skipped != skipped
+	entry.skipped = skipped
+	return changed
+}
+
+func (s *Store) setOverride(override Override) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[override.Name]
+	if !ok {
+		return errors.Errorf("unknown check: %s", override.Name)
+	}
+	entry.override = &override
+	return nil
+}
+
+func (s *Store) clearOverride(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[name]
+	if !ok || entry.override == nil {
+		return false
+	}
+	entry.override = nil
+	return true
+}
+
+// expireOverride - 删除过期的覆盖, 返回是否删除
+func (s *Store) expireOverride(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.entries[name]
+	if entry.override == nil || entry.override.active(time.Now()) {
+		return false
+	}
+	entry.override = nil
+	return true
+}
+
+// Override - 返回检查未过期的覆盖, 没有覆盖返回nil
+func (s *Store) Override(name string) *Override {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[name]
+	if !ok || !entry.override.active(time.Now()) {
+		return nil
+	}
+	override := *entry.override
+	return &override
+}
+
+// Overrides - 按注册顺序返回所有未过期的覆盖
+func (s *Store) Overrides() []Override {
+	s.mu.RLock()
+	names := s.names
+	s.mu.RUnlock()
+	overrides := []Override{}
+	for _, name := range names {
+		if override := s.Override(name); override != nil {
+			overrides = append(overrides, *override)
+		}
+	}
+	return overrides
+}
+
+// State - 返回检查状态, 有覆盖时返回覆盖的状态, 检查不存在或者被跳过返回unknown
+func (s *Store) State(name string) State {
+	if override := s.Override(name); override != nil {
+		return override.State()
+	}
+	s.mu.RLock()
+	entry, ok := s.entries[name]
+	skipped := ok && entry.skipped
+	s.mu.RUnlock()
+	if !ok || skipped {
+		return StateUnknown
+	}
+	return entry.tracker.State()
+}
+
+// Status - 返回检查状态快照
+func (s *Store) Status(name string) (CheckStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[name]
+	if !ok {
+		return CheckStatus{}, false
+	}
+	status := CheckStatus{
+		Name:          name,
+		Skipped:       entry.skipped,
+		TrackerStatus: entry.tracker.Status(),
+	}
+	if entry.override.active(time.Now()) {
+		override := *entry.override
+		status.Override = &override
+		// 状态为覆盖后的状态, 其他字段为最近一次执行的结果
+		status.State = override.State().String()
+	}
+	if !entry.lastRun.IsZero() {
+		lastRun := entry.lastRun
+		status.LastRun = &lastRun
+		status.Duration = entry.duration.String()
+	}
+	return status, true
+}
+
+// All - 按注册顺序返回所有检查状态快照
+func (s *Store) All() []CheckStatus {
+	s.mu.RLock()
+	names := s.names
+	s.mu.RUnlock()
+	var all []CheckStatus
+	for _, name := range names {
+		if status, ok := s.Status(name); ok {
+			all = append(all, status)
+		}
+	}
+	return all
+}
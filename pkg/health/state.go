@@ -0,0 +1,124 @@
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+// State - 检查状态
+type State int
+
+const (
+	StateUnknown State = iota // 启动后还未达到rise/fall次数
+	StatePassing
+	StateFailing
+)
+
+func (s State) String() string {
+	switch s {
+	case StatePassing:
+		return "passing"
+	case StateFailing:
+		return "failing"
+	default:
+		return "unknown"
+	}
+}
+
+// Tracker - 根据连续成功(rise)、连续失败(fall)次数计算检查状态, 状态变化后holdDown时间内不再变化
+type Tracker struct {
+	mu          sync.Mutex
+	rise        int
+	fall        int
+	holdDown    time.Duration
+	state       State
+	successes   int
+	failures    int
+	changedAt   time.Time
+	transitions int
+	lastErr     error
+}
+
+// NewTracker - rise、fall小于1时为1
+func NewTracker(rise, fall int, holdDown time.Duration) *Tracker {
+	if rise < 1 {
+		rise = 1
+	}
+	if fall < 1 {
+		fall = 1
+	}
+	return &Tracker{
+		rise:     rise,
+		fall:     fall,
+		holdDown: holdDown,
+	}
+}
+
+// Record - 记录一次检查结果, 返回当前状态和状态是否发生变化
+func (t *Tracker) Record(err error) (State, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastErr = err
+	next := t.state
+	if err == nil {
+		t.successes++
+		t.failures = 0
+		if t.successes >= t.rise {
+			next = StatePassing
+		}
+	} else {
+		t.failures++
+		t.successes = 0
+		if t.failures >= t.fall {
+			next = StateFailing
+		}
+	}
+	if next == t.state {
+		return t.state, false
+	}
+	// 抑制抖动, 首次确定状态不受限制
+	if t.state != StateUnknown && time.Since(t.changedAt) < t.holdDown {
+		return t.state, false
+	}
+	t.state = next
+	t.changedAt = time.Now()
+	t.transitions++
+	return t.state, true
+}
+
+// State - 返回当前状态
+func (t *Tracker) State() State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state
+}
+
+// TrackerStatus - 检查状态快照
+type TrackerStatus struct {
+	State       string     `json:"state"`
+	Since       *time.Time `json:"since,omitempty"`
+	Transitions int        `json:"transitions"`
+	Successes   int        `json:"successes"`
+	Failures    int        `json:"failures"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+// Status - 返回检查状态快照
+func (t *Tracker) Status() TrackerStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := TrackerStatus{
+		State:       t.state.String(),
+		Transitions: t.transitions,
+		Successes:   t.successes,
+		Failures:    t.failures,
+	}
+	if !t.changedAt.IsZero() {
+		since := t.changedAt
+		status.Since = &since
+	}
+	if t.lastErr != nil {
+		status.LastError = t.lastErr.Error()
+	}
+	return status
+}
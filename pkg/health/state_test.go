@@ -0,0 +1,93 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var errCheck = errors.New("check failed")
+
+func TestTrackerRiseFall(t *testing.T) {
+	tests := []struct {
+		name       string
+		rise, fall int
+		results    []error
+		want       []State
+	}{
+		{
+			name:    "rise 2",
+			rise:    2,
+			fall:    2,
+			results: []error{nil, nil, nil},
+			want:    []State{StateUnknown, StatePassing, StatePassing},
+		},
+		{
+			name:    "fall 3",
+			rise:    1,
+			fall:    3,
+			results: []error{nil, errCheck, errCheck, errCheck},
+			want:    []State{StatePassing, StatePassing, StatePassing, StateFailing},
+		},
+		{
+			name:    "success resets failures",
+			rise:    1,
+			fall:    2,
+			results: []error{nil, errCheck, nil, errCheck, errCheck},
+			want:    []State{StatePassing, StatePassing, StatePassing, StatePassing, StateFailing},
+		},
+		{
+			name:    "failure resets successes",
+			rise:    2,
+			fall:    1,
+			results: []error{errCheck, nil, errCheck, nil, nil},
+			want:    []State{StateFailing, StateFailing, StateFailing, StateFailing, StatePassing},
+		},
+		{
+			name:    "rise and fall below 1",
+			results: []error{errCheck, nil},
+			want:    []State{StateFailing, StatePassing},
+		},
+	}
+	for _, tt := range tests {
+		tracker := NewTracker(tt.rise, tt.fall, 0)
+		for i, err := range tt.results {
+			if got, _ := tracker.Record(err); got != tt.want[i] {
+				t.Errorf("%s: result %d state = %s, want %s", tt.name, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestTrackerChanged(t *testing.T) {
+	tracker := NewTracker(1, 1, 0)
+	if _, changed := tracker.Record(nil); !changed {
+		t.Error("unknown -> passing should be a change")
+	}
+	if _, changed := tracker.Record(nil); changed {
+		t.Error("passing -> passing should not be a change")
+	}
+	if _, changed := tracker.Record(errCheck); !changed {
+		t.Error("passing -> failing should be a change")
+	}
+	if status := tracker.Status(); status.Transitions != 2 || status.LastError != errCheck.Error() {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestTrackerHoldDown(t *testing.T) {
+	tracker := NewTracker(1, 1, time.Minute)
+	// 首次确定状态不受holdDown限制
+	if state, _ := tracker.Record(nil); state != StatePassing {
+		t.Fatalf("state = %s, want passing", state)
+	}
+	if state, changed := tracker.Record(errCheck); state != StatePassing || changed {
+		t.Errorf("within hold down state = %s changed = %v, want passing without change", state, changed)
+	}
+	tracker.mu.Lock()
+	tracker.changedAt = time.Now().Add(-2 * time.Minute)
+	tracker.mu.Unlock()
+	if state, changed := tracker.Record(errCheck); state != StateFailing || !changed {
+		t.Errorf("after hold down state = %s changed = %v, want failing with change", state, changed)
+	}
+}
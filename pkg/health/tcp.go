@@ -0,0 +1,19 @@
+package health
+
+import (
+	"keep-vip/pkg/network"
+)
+
+// TCPChecker - TCP端口检查
+type TCPChecker struct {
+	Address string
+	Timeout int
+}
+
+// Check - 连接TCP端口
+func (t *TCPChecker) Check() error {
+	if err := network.CheckTcpAddress(t.Address, t.Timeout); err != nil {
+		return failure(ReasonConnect, err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package health
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/pkg/errors"
+	"keep-vip/pkg/zlog"
+	"net"
+	"sync"
+	"time"
+)
+
+// TLSCheckOptions - TLS握手和证书有效期检查配置
+type TLSCheckOptions struct {
+	Name     string // 检查名称, 用于日志
+	Address  string // host:port
+	TLS      TLSOptions
+	WarnDays int // 证书剩余有效天数少于该值时输出警告, 0不警告
+	FailDays int // 证书剩余有效天数少于该值时检查失败, 0只在过期时失败
+	Timeout  int // 单位s, 连接和握手的总超时时间
+}
+
+// TLSChecker - 完成TLS握手并校验证书链, 检查服务端证书的有效期
+type TLSChecker struct {
+	name     string
+	address  string
+	config   *tls.Config
+	warn     time.Duration
+	fail     time.Duration
+	timeout  time.Duration
+	mu       sync.Mutex
+	notAfter time.Time
+}
+
+// NewTLSChecker - 校验配置并创建TLS检查, SNI为空时使用地址中的主机名
+func NewTLSChecker(o TLSCheckOptions) (*TLSChecker, error) {
+	host, _, err := net.SplitHostPort(o.Address)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if o.WarnDays < 0 || o.FailDays < 0 {
+		return nil, errors.New("tls expiry days cannot be negative")
+	}
+	config, err := o.TLS.Config()
+	if err != nil {
+		return nil, err
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	return &TLSChecker{
+		name:    o.Name,
+		address: o.Address,
+		config:  config,
+		warn:    time.Hour * 24 * time.Duration(o.WarnDays),
+		fail:    time.Hour * 24 * time.Duration(o.FailDays),
+		timeout: Timeout(o.Timeout),
+	}, nil
+}
+
+// Check - 建立连接并完成握手, 证书校验失败或者即将过期时失败
+func (t *TLSChecker) Check() error {
+	deadline := time.Now().Add(t.timeout)
+	conn, err := net.DialTimeout("tcp", t.address, t.timeout)
+	if err != nil {
+		return failure(requestReason(err), errors.Wrapf(err, "dial %s", t.address))
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return failure(ReasonError, errors.WithStack(err))
+	}
+
+	tlsConn := tls.Client(conn, t.config)
+	if err := tlsConn.Handshake(); err != nil {
+		if isTimeout(err) {
+			return failure(ReasonTimeout, errors.Wrapf(err, "handshake %s", t.address))
+		}
+		var invalidErr x509.CertificateInvalidError
+		if errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired {
+			return failure(ReasonExpiry, errors.Wrapf(err, "handshake %s", t.address))
+		}
+		return failure(ReasonTLS, errors.Wrapf(err, "handshake %s", t.address))
+	}
+	certificates := tlsConn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return failure(ReasonTLS, errors.Errorf("%s presented no certificate", t.address))
+	}
+
+	leaf := certificates[0]
+	t.mu.Lock()
+	t.notAfter = leaf.NotAfter
+	t.mu.Unlock()
+	remaining := time.Until(leaf.NotAfter)
+	switch {
+	case remaining <= 0:
+		return failure(ReasonExpiry, errors.Errorf("%s certificate '%s' expired at %s",
+			t.address, leaf.Subject, leaf.NotAfter.Format(time.RFC3339)))
+	case remaining < t.fail:
+		return failure(ReasonExpiry, errors.Errorf("%s certificate '%s' expires in %d days",
+			t.address, leaf.Subject, int(remaining.Hours()/24)))
+	case remaining < t.warn:
+		zlog.Warn(fmt.Sprintf("Check %s: %s certificate '%s' expires in %d days",
+			t.name, t.address, leaf.Subject, int(remaining.Hours()/24)))
+	}
+	return nil
+}
+
+// NotAfter - 最近一次检查得到的证书过期时间, 还没有完成握手时为零值
+func (t *TLSChecker) NotAfter() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.notAfter
+}
@@ -0,0 +1,44 @@
+package health
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"os"
+)
+
+// TLSOptions - 检查使用的TLS客户端配置
+type TLSOptions struct {
+	InsecureSkipVerify bool   // 不校验服务端证书
+	ServerName         string // SNI, 同时用于校验证书
+	CaFile             string // CA证书, 为空使用系统CA
+	CertFile           string // 客户端证书
+	KeyFile            string // 客户端私钥
+}
+
+// Config - 生成tls.Config
+func (o TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		ServerName:         o.ServerName,
+	}
+	if o.CaFile != "" {
+		pem, err := os.ReadFile(o.CaFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in %s", o.CaFile)
+		}
+		config.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// UDPOptions - UDP检查配置
+type UDPOptions struct {
+	Address        string // host:port
+	Payload        string // 发送的内容
+	PayloadHex     string // 发送的内容, 十六进制, 优先于payload
+	ExpectReply    bool   // 是否期望收到回复
+	ExpectContains string // 回复包含的内容
+	Timeout        int    // 单位s
+}
+
+// UDPChecker - 发送UDP报文. 不期望回复时, 超时未收到ICMP端口不可达即为健康
+type UDPChecker struct {
+	address        string
+	payload        []byte
+	expectReply    bool
+	expectContains []byte
+	timeout        time.Duration
+}
+
+// NewUDPChecker - 校验配置并创建UDP检查
+func NewUDPChecker(o UDPOptions) (*UDPChecker, error) {
+	if _, _, err := net.SplitHostPort(o.Address); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	u := &UDPChecker{
+		address:     o.Address,
+		payload:     []byte(o.Payload),
+		expectReply: o.ExpectReply || o.ExpectContains != "",
+		timeout:     Timeout(o.Timeout),
+	}
+	if o.PayloadHex != "" {
+		payload, err := hex.DecodeString(o.PayloadHex)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		u.payload = payload
+	}
+	if o.ExpectContains != "" {
+		u.expectContains = []byte(o.ExpectContains)
+	}
+	return u, nil
+}
+
+// Check - 发送报文并等待回复
+func (u *UDPChecker) Check() error {
+	conn, err := net.DialTimeout("udp", u.address, u.timeout)
+	if err != nil {
+		return failure(ReasonConnect, errors.WithStack(err))
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(u.timeout)); err != nil {
+		return failure(ReasonError, errors.WithStack(err))
+	}
+	if _, err := conn.Write(u.payload); err != nil {
+		return failure(ReasonConnect, errors.WithStack(err))
+	}
+
+	reply := make([]byte, 64*1024)
+	n, err := conn.Read(reply)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			if !u.expectReply {
+				return nil
+			}
+			return failure(ReasonTimeout, errors.Errorf("no reply from %s within %s", u.address, u.timeout))
+		}
+		// 收到ICMP端口不可达
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return failure(ReasonConnect, errors.Wrapf(err, "port unreachable %s", u.address))
+		}
+		return failure(ReasonConnect, errors.WithStack(err))
+	}
+	if u.expectContains != nil && !bytes.Contains(reply[:n], u.expectContains) {
+		return failure(ReasonBody, errors.Errorf("reply from %s does not contain %q", u.address, u.expectContains))
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package loadbalancer
+
+import (
+	"github.com/pkg/errors"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 负载均衡算法
+const (
+	AlgorithmRoundRobin = "roundrobin" // 平滑加权轮询
+	AlgorithmLeastConn  = "leastconn"  // 加权最少连接
+	AlgorithmP2C        = "p2c"        // 随机选择两个后端, 使用加权连接数较少的一个
+	AlgorithmSourceHash = "sourcehash" // 客户端IP一致性哈希, 会话保持
+)
+
+// selector - 从健康的后端中选择一个, 每个负载均衡独立的状态
+type selector interface {
+	next(healthy []*Backend, client net.Addr) *Backend
+}
+
+// newSelector - 根据算法创建选择器
+func newSelector(algorithm string, backends []*Backend) (selector, error) {
+	switch algorithm {
+	case AlgorithmRoundRobin:
+		return &roundRobin{current: make(map[*Backend]int)}, nil
+	case AlgorithmLeastConn:
+		return &leastConn{}, nil
+	case AlgorithmP2C:
+		return &powerOfTwo{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+	case AlgorithmSourceHash:
+		return newSourceHash(backends), nil
+	default:
+		return nil, errors.Errorf("the algorithm is not supported: %s", algorithm)
+	}
+}
+
+// roundRobin - 平滑加权轮询: 每次所有后端的当前值加上权重, 选择当前值最大的后端并减去总权重.
+// 健康的后端变化时重新计算, 避免摘除或恢复的后端保留之前累计的当前值
+type roundRobin struct {
+	mu         sync.Mutex
+	current    map[*Backend]int
+	candidates []*Backend
+}
+
+func (r *roundRobin) next(healthy []*Backend, _ net.Addr) *Backend {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !sameBackends(r.candidates, healthy) {
+		r.current = make(map[*Backend]int, len(healthy))
+		r.candidates = append(r.candidates[:0], healthy...)
+	}
+	var (
+		best  *Backend
+		total int
+	)
+	for _, backend := range healthy {
+		r.current[backend] += backend.weight()
+		total += backend.weight()
+		if best == nil || r.current[backend] > r.current[best] {
+			best = backend
+		}
+	}
+	r.current[best] -= total
+	return best
+}
+
+// sameBackends - 两组后端是否相同
+func sameBackends(a, b []*Backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// load - 加权连接数
+func load(backend *Backend) float64 {
+	return float64(backend.Connections()) / float64(backend.weight())
+}
+
+// leastConn - 选择加权连接数最少的后端, 相同时轮流选择
+type leastConn struct {
+	mu     sync.Mutex
+	offset int
+}
+
+func (l *leastConn) next(healthy []*Backend, _ net.Addr) *Backend {
+	l.mu.Lock()
+	l.offset++
+	offset := l.offset
+	l.mu.Unlock()
+	var best *Backend
+	for i := range healthy {
+		backend := healthy[(offset+i)%len(healthy)]
+		if best == nil || load(backend) < load(best) {
+			best = backend
+		}
+	}
+	return best
+}
+
+// powerOfTwo - 随机选择两个后端, 使用加权连接数较少的一个
+type powerOfTwo struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (p *powerOfTwo) next(healthy []*Backend, _ net.Addr) *Backend {
+	if len(healthy) == 1 {
+		return healthy[0]
+	}
+	p.mu.Lock()
+	i := p.rand.Intn(len(healthy))
+	j := p.rand.Intn(len(healthy) - 1)
+	p.mu.Unlock()
+	if j >= i {
+		j++
+	}
+	if load(healthy[j]) < load(healthy[i]) {
+		return healthy[j]
+	}
+	return healthy[i]
+}
+
+// sourceHashReplicas - 每个权重在哈希环上的虚拟节点数
+const sourceHashReplicas = 160
+
+// sourceHash - 客户端IP一致性哈希. 哈希环包含所有后端, 后端不健康时顺时针选择下一个健康的后端, 其他客户端不受影响
+type sourceHash struct {
+	points   []uint64
+	backends map[uint64]*Backend
+}
+
+func newSourceHash(backends []*Backend) *sourceHash {
+	s := &sourceHash{backends: make(map[uint64]*Backend)}
+	for _, backend := range backends {
+		for i := 0; i < sourceHashReplicas*backend.weight(); i++ {
+			point := hash(backend.Address.String() + "#" + strconv.Itoa(i))
+			if _, ok := s.backends[point]; ok {
+				continue
+			}
+			s.backends[point] = backend
+			s.points = append(s.points, point)
+		}
+	}
+	sort.Slice(s.points, func(i, j int) bool {
+		return s.points[i] < s.points[j]
+	})
+	return s
+}
+
+func (s *sourceHash) next(healthy []*Backend, client net.Addr) *Backend {
+	ip := client.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	available := make(map[*Backend]bool, len(healthy))
+	for _, backend := range healthy {
+		available[backend] = true
+	}
+	point := hash(ip)
+	start := sort.Search(len(s.points), func(i int) bool {
+		return s.points[i] >= point
+	})
+	for i := 0; i < len(s.points); i++ {
+		backend := s.backends[s.points[(start+i)%len(s.points)]]
+		if available[backend] {
+			return backend
+		}
+	}
+	return healthy[0]
+}
+
+// hash - 64位哈希. 虚拟节点的key只有后缀不同, FNV直接使用时在环上分布不均匀, 使用murmur3的fmix64打散
+func hash(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,175 @@
+package loadbalancer
+
+import (
+	"net"
+	"testing"
+)
+
+func pick(t *testing.T, lb *LoadBalancer, client net.Addr, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		backend, err := lb.ReturnBackend(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[backend.Name]++
+	}
+	return counts
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	lb := &LoadBalancer{Name: "test", Algorithm: "random"}
+	if err := lb.init(); err == nil {
+		t.Fatal("init accepted an unknown algorithm")
+	}
+	lb = &LoadBalancer{Name: "test", Algorithm: "LeastConn", Backends: []*Backend{{Name: "a"}}}
+	if err := lb.init(); err != nil || lb.Algorithm != AlgorithmLeastConn || lb.Backends[0].Weight != 1 {
+		t.Fatalf("init = %v, algorithm %s, weight %d", err, lb.Algorithm, lb.Backends[0].Weight)
+	}
+}
+
+func TestRoundRobinWeights(t *testing.T) {
+	lb := newTestLB(t, AlgorithmRoundRobin, 3, 1, 1)
+	var sequence string
+	for i := 0; i < 5; i++ {
+		backend, _ := lb.ReturnBackend(nil)
+		sequence += backend.Name
+	}
+	// 平滑加权轮询不会连续选择同一个后端
+	if sequence != "abaca" {
+		t.Fatalf("sequence = %s, want abaca", sequence)
+	}
+	counts := pick(t, lb, nil, 50)
+	if counts["a"] != 30 || counts["b"] != 10 || counts["c"] != 10 {
+		t.Fatalf("counts = %v, want a:30 b:10 c:10", counts)
+	}
+}
+
+func TestRoundRobinResetOnChange(t *testing.T) {
+	lb := newTestLB(t, AlgorithmRoundRobin, 5, 1)
+	// 选择到周期中间, b累计了当前值
+	pick(t, lb, nil, 3)
+	lb.Backends[1].SetFailing(true)
+	pick(t, lb, nil, 4)
+	lb.Backends[1].SetFailing(false)
+	// 恢复后从新的周期开始
+	var sequence string
+	for i := 0; i < 6; i++ {
+		backend, _ := lb.ReturnBackend(nil)
+		sequence += backend.Name
+	}
+	if sequence != "aaabaa" {
+		t.Fatalf("sequence after recovery = %s, want aaabaa", sequence)
+	}
+}
+
+func TestLeastConn(t *testing.T) {
+	lb := newTestLB(t, AlgorithmLeastConn, 1, 1, 1)
+	lb.Backends[0].connections = 5
+	lb.Backends[1].connections = 1
+	lb.Backends[2].connections = 3
+	if counts := pick(t, lb, nil, 10); counts["b"] != 10 {
+		t.Fatalf("counts = %v, want all b", counts)
+	}
+	// 按权重计算: a 20/10 < b 3/1
+	lb.Backends[0].Weight = 10
+	lb.Backends[0].connections = 20
+	lb.Backends[1].connections = 3
+	if counts := pick(t, lb, nil, 10); counts["a"] != 10 {
+		t.Fatalf("weighted counts = %v, want all a", counts)
+	}
+	// 连接数相同时轮流选择
+	for _, backend := range lb.Backends {
+		backend.Weight = 1
+		backend.connections = 0
+	}
+	if counts := pick(t, lb, nil, 30); counts["a"] != 10 || counts["b"] != 10 || counts["c"] != 10 {
+		t.Fatalf("tie counts = %v, want 10 each", counts)
+	}
+}
+
+func TestPowerOfTwo(t *testing.T) {
+	lb := newTestLB(t, AlgorithmP2C, 1, 1)
+	lb.Backends[0].connections = 10
+	if counts := pick(t, lb, nil, 20); counts["b"] != 20 {
+		t.Fatalf("counts = %v, want all b", counts)
+	}
+	lb.Backends[1].SetFailing(true)
+	if counts := pick(t, lb, nil, 5); counts["a"] != 5 {
+		t.Fatalf("single healthy counts = %v, want all a", counts)
+	}
+	lb = newTestLB(t, AlgorithmP2C, 1, 1, 1, 1)
+	if counts := pick(t, lb, nil, 400); len(counts) != 4 {
+		t.Fatalf("counts = %v, want all backends selected", counts)
+	}
+}
+
+func TestSourceHash(t *testing.T) {
+	lb := newTestLB(t, AlgorithmSourceHash, 1, 1, 1)
+	clients := make([]net.Addr, 200)
+	before := make([]*Backend, len(clients))
+	for i := range clients {
+		clients[i] = &net.TCPAddr{IP: net.IPv4(10, byte(i/7), byte(i*13), byte(i)), Port: 40000 + i}
+		backend, err := lb.ReturnBackend(clients[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[i] = backend
+		// 同一个IP的其他端口选择同一个后端
+		again, _ := lb.ReturnBackend(&net.TCPAddr{IP: clients[i].(*net.TCPAddr).IP, Port: 50000})
+		if again != backend {
+			t.Fatalf("client %s selected %s then %s", clients[i], backend.Name, again.Name)
+		}
+	}
+
+	// 摘除一个后端, 只有原来选择该后端的客户端变化
+	lb.Backends[2].SetFailing(true)
+	var moved int
+	for i, client := range clients {
+		backend, _ := lb.ReturnBackend(client)
+		switch {
+		case before[i] == lb.Backends[2]:
+			moved++
+			if backend == lb.Backends[2] {
+				t.Fatalf("client %s selected unhealthy backend", client)
+			}
+		case backend != before[i]:
+			t.Fatalf("client %s moved from %s to %s", client, before[i].Name, backend.Name)
+		}
+	}
+	if moved == 0 {
+		t.Fatal("no client was mapped to backend c")
+	}
+
+	// 恢复后回到原来的后端
+	lb.Backends[2].SetFailing(false)
+	for i, client := range clients {
+		if backend, _ := lb.ReturnBackend(client); backend != before[i] {
+			t.Fatalf("client %s selected %s after recovery, want %s", client, backend.Name, before[i].Name)
+		}
+	}
+
+	// 每个后端分到的客户端比例接近权重比例, 误差不超过4个百分点
+	for _, weights := range [][]int{{1, 1, 1}, {3, 1}, {2, 1, 1}, {1, 1, 1, 1, 1}} {
+		lb := newTestLB(t, AlgorithmSourceHash, weights...)
+		const total = 60000
+		counts := make(map[*Backend]int)
+		for i := 0; i < total; i++ {
+			client := &net.TCPAddr{IP: net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)), Port: 40000}
+			backend, _ := lb.ReturnBackend(client)
+			counts[backend]++
+		}
+		var weightSum int
+		for _, weight := range weights {
+			weightSum += weight
+		}
+		for _, backend := range lb.Backends {
+			share := float64(counts[backend]) / total
+			want := float64(backend.Weight) / float64(weightSum)
+			if share < want-0.04 || share > want+0.04 {
+				t.Errorf("weights %v: backend %s share %.3f, want %.3f", weights, backend.Name, share, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package loadbalancer
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io"
+	"keep-vip/pkg/zlog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTPOptions - 7层代理配置
+type HTTPOptions struct {
+	Timeout  time.Duration // 请求超时, 不包括websocket, 0不限制
+	CertFile string        // 证书和私钥都配置时使用https, 否则使用http. 都支持http2
+	KeyFile  string
+}
+
+// Route - 按host和path前缀路由到后端池, 按顺序匹配
+type Route struct {
+	Host string // 为空匹配所有, 支持*.example.com
+	Path string // 路径前缀, 按路径段匹配, /api匹配/api和/api/users, 不匹配/apiv2. 为空匹配所有
+	Pool string // 后端池的负载均衡名称
+
+	pool *LoadBalancer
+}
+
+// match - 是否匹配请求
+func (r *Route) match(host, path string) bool {
+	if r.Host != "" {
+		if strings.HasPrefix(r.Host, "*.") {
+			if !strings.HasSuffix(host, r.Host[1:]) {
+				return false
+			}
+		} else if !strings.EqualFold(host, r.Host) {
+			return false
+		}
+	}
+	if r.Path == "" || path == r.Path {
+		return true
+	}
+	return strings.HasPrefix(path, r.Path) && (strings.HasSuffix(r.Path, "/") || path[len(r.Path)] == '/')
+}
+
+// LoadBalancers - 返回负载均衡和它的所有后端池
+func (lb *LoadBalancer) LoadBalancers() []*LoadBalancer {
+	return append([]*LoadBalancer{lb}, lb.Pools...)
+}
+
+// initRoutes - 初始化后端池和路由
+func (lb *LoadBalancer) initRoutes() error {
+	pools := make(map[string]*LoadBalancer, len(lb.Pools))
+	for _, pool := range lb.Pools {
+		if err := pool.init(); err != nil {
+			return err
+		}
+		pools[pool.Name] = pool
+	}
+	for i := range lb.Routes {
+		route := &lb.Routes[i]
+		route.Host = strings.ToLower(route.Host)
+		if route.Pool == "" {
+			route.pool = lb
+			continue
+		}
+		pool, ok := pools[route.Pool]
+		if !ok {
+			return errors.Errorf("Load Balancer [%s] route %s%s unknown pool: %s", lb.Name, route.Host, route.Path, route.Pool)
+		}
+		route.pool = pool
+	}
+	return nil
+}
+
+// route - 返回请求的后端池, 没有匹配的路由时使用负载均衡自己的后端
+func (lb *LoadBalancer) route(r *http.Request) *LoadBalancer {
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for i := range lb.Routes {
+		if lb.Routes[i].match(host, r.URL.Path) {
+			return lb.Routes[i].pool
+		}
+	}
+	return lb
+}
+
+type proxyContextKey struct{}
+
+// proxyRequest - 请求选择的后端池和客户端地址, 通过context传给transport
+type proxyRequest struct {
+	pool   *LoadBalancer
+	client net.Addr
+}
+
+func (li *LBInstance) startHTTP() error {
+	lb := li.LoadBalancer
+	listen, err := net.ListenTCP("tcp", lb.BindAddress)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tlsEnabled := lb.HTTP.CertFile != "" && lb.HTTP.KeyFile != ""
+	transport := &proxyTransport{
+		lb: lb,
+		transport: &http.Transport{
+			DialContext:         (&net.Dialer{Timeout: lb.Retry.ConnectTimeout}).DialContext,
+			MaxIdleConnsPerHost: 100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			if tlsEnabled {
+				r.Header.Set("X-Forwarded-Proto", "https")
+			} else {
+				r.Header.Set("X-Forwarded-Proto", "http")
+			}
+			// 客户端传入的值不可信, 和X-Forwarded-Proto一样总是覆盖
+			r.Header.Set("X-Forwarded-Host", r.Host)
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			zlog.Warn(fmt.Sprintf("[%s]---X [FAILED] X-->[%s] %s %s: %v", r.RemoteAddr, lb.Name, r.Method, r.URL.Path, err))
+			if errors.Is(err, errNoBackend) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				w.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pool := lb.route(r)
+		if len(pool.Backends) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		ctx := r.Context()
+		// websocket是长连接, 不限制时间
+		if lb.HTTP.Timeout > 0 && !isUpgrade(r) {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, lb.HTTP.Timeout)
+			defer cancel()
+		}
+		client, _ := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+		ctx = context.WithValue(ctx, proxyContextKey{}, &proxyRequest{pool: pool, client: client})
+		proxy.ServeHTTP(w, r.WithContext(ctx))
+	})
+	server := &http.Server{Handler: handler}
+	if tlsEnabled {
+		// ServeTLS自动启用http2
+		if err := http2.ConfigureServer(server, &http2.Server{}); err != nil {
+			listen.Close()
+			return errors.WithStack(err)
+		}
+	} else {
+		// 明文http2
+		server.Handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	serve := func(listen net.Listener) {
+		var err error
+		if tlsEnabled {
+			err = server.ServeTLS(listen, lb.HTTP.CertFile, lb.HTTP.KeyFile)
+		} else {
+			err = server.Serve(listen)
+		}
+		if err != nil && err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+			zlog.Error(errors.WithStack(err))
+		}
+	}
+	go serve(listen)
+	go func() {
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-li.stop:
+				if err := server.Close(); err != nil {
+					zlog.Warn(err.Error())
+				}
+				transport.transport.CloseIdleConnections()
+				close(li.stopped)
+				return
+			case <-ticker.C:
+				// 排空时关闭监听, 已有请求继续处理, 恢复后重新监听
+				if atomic.LoadInt32(&li.draining) == 1 {
+					if listen != nil {
+						server.SetKeepAlivesEnabled(false)
+						listen.Close()
+						listen = nil
+						zlog.Info(fmt.Sprintf("Load Balancer instance [%s] is draining", lb.Name))
+					}
+					continue
+				}
+				if listen == nil {
+					if listen, err = net.ListenTCP("tcp", lb.BindAddress); err != nil {
+						zlog.Error(errors.WithStack(err))
+						listen = nil
+						continue
+					}
+					server.SetKeepAlivesEnabled(true)
+					go serve(listen)
+					zlog.Info(fmt.Sprintf("Load Balancer instance [%s] resumed", lb.Name))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// isUpgrade - 是否websocket等协议升级请求
+func isUpgrade(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+// idempotent - 可以重试的请求: 幂等方法且没有请求体
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return r.ContentLength == 0 && len(r.TransferEncoding) == 0
+}
+
+var errNoBackend = errors.New("no healthy backends")
+
+// proxyTransport - 选择后端并转发请求, 连接失败时按重试策略重试幂等请求
+type proxyTransport struct {
+	lb        *LoadBalancer
+	transport *http.Transport
+}
+
+func (t *proxyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	proxied, _ := r.Context().Value(proxyContextKey{}).(*proxyRequest)
+	if proxied == nil {
+		return nil, errNoBackend
+	}
+	attempts := t.lb.Retry.MaxAttempts
+	if attempts < 1 || !idempotent(r) {
+		attempts = 1
+	}
+	backoff := t.lb.Retry.Backoff
+	var lastErr error
+	tried := make(map[*Backend]bool)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		backend, err := proxied.pool.returnBackend(proxied.client, tried)
+		if err != nil {
+			zlog.Debug(err.Error())
+			t.failed(FailureNoBackend)
+			return nil, errors.WithStack(errNoBackend)
+		}
+		r.URL.Host = backend.Address.String()
+		resp, err := t.transport.RoundTrip(r)
+		if err == nil {
+			backend.reportSuccess()
+			zlog.Debug(fmt.Sprintf("[%s]--->[ACCEPT]--->[%s] %s %s", proxied.client, backend.Address.String(), r.Method, r.URL.Path))
+			atomic.AddInt64(&backend.connections, 1)
+			resp.Body = countBody(resp.Body, backend)
+			return resp, nil
+		}
+		lastErr = err
+		// 客户端取消或者请求超时不重试, 也不计入后端失败
+		if r.Context().Err() != nil {
+			return nil, err
+		}
+		zlog.Debug(fmt.Sprintf("[%s]---X [FAILED] X-->[%s] attempt %d/%d: %v",
+			proxied.client, backend.Address.String(), attempt, attempts, err))
+		backend.reportFailure(proxied.pool)
+		tried[backend] = true
+		if attempt < attempts {
+			select {
+			case <-r.Context().Done():
+				return nil, r.Context().Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+	t.failed(FailureAttempts)
+	return nil, lastErr
+}
+
+func (t *proxyTransport) failed(reason string) {
+	if t.lb.OnConnectFailure != nil {
+		t.lb.OnConnectFailure(t.lb, reason)
+	}
+}
+
+// countBody - 响应体关闭时减少后端连接数. websocket的响应体需要保留io.Writer
+func countBody(body io.ReadCloser, backend *Backend) io.ReadCloser {
+	counted := &countedBody{ReadCloser: body, backend: backend}
+	if rwc, ok := body.(io.ReadWriteCloser); ok {
+		return &countedRWBody{countedBody: counted, writer: rwc}
+	}
+	return counted
+}
+
+type countedBody struct {
+	io.ReadCloser
+	backend *Backend
+	once    sync.Once
+}
+
+func (b *countedBody) Close() error {
+	b.once.Do(func() {
+		atomic.AddInt64(&b.backend.connections, -1)
+	})
+	return b.ReadCloser.Close()
+}
+
+type countedRWBody struct {
+	*countedBody
+	writer io.Writer
+}
+
+func (b *countedRWBody) Write(p []byte) (int, error) {
+	return b.writer.Write(p)
+}
@@ -0,0 +1,243 @@
+package loadbalancer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRouteMatch(t *testing.T) {
+	tests := []struct {
+		route Route
+		host  string
+		path  string
+		want  bool
+	}{
+		{Route{}, "any.com", "/", true},
+		{Route{Host: "api.example.com"}, "api.example.com", "/v1", true},
+		{Route{Host: "api.example.com"}, "API.Example.com", "/v1", true},
+		{Route{Host: "api.example.com"}, "www.example.com", "/v1", false},
+		{Route{Host: "*.example.com"}, "api.example.com", "/", true},
+		{Route{Host: "*.example.com"}, "a.b.example.com", "/", true},
+		{Route{Host: "*.example.com"}, "example.com", "/", false},
+		{Route{Host: "*.example.com"}, "badexample.com", "/", false},
+		{Route{Path: "/api"}, "any.com", "/api/users", true},
+		{Route{Path: "/api"}, "any.com", "/api", true},
+		{Route{Path: "/api"}, "any.com", "/apiv2", false},
+		{Route{Path: "/api/"}, "any.com", "/api/users", true},
+		{Route{Path: "/api/"}, "any.com", "/api", false},
+		{Route{Path: "/api"}, "any.com", "/static", false},
+		{Route{Host: "api.example.com", Path: "/v2"}, "api.example.com", "/v1", false},
+		{Route{Host: "api.example.com", Path: "/v2"}, "api.example.com", "/v2/users", true},
+	}
+	for _, test := range tests {
+		if got := test.route.match(test.host, test.path); got != test.want {
+			t.Errorf("route %s%s match(%s, %s) = %v, want %v", test.route.Host, test.route.Path, test.host, test.path, got, test.want)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	lb := &LoadBalancer{
+		Name: "web",
+		Pools: []*LoadBalancer{
+			{Name: "api", Backends: []*Backend{{Name: "api-01"}}},
+			{Name: "static", Backends: []*Backend{{Name: "static-01"}}},
+		},
+		Routes: []Route{
+			{Host: "API.example.com", Pool: "api"},
+			{Path: "/static", Pool: "static"},
+			{Path: "/self"},
+		},
+	}
+	if err := lb.initRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		target string
+		want   *LoadBalancer
+	}{
+		// 配置的host转为小写, 请求的host去掉端口
+		{"http://api.example.com:8080/static/a.css", lb.Pools[0]},
+		{"http://www.example.com/static/a.css", lb.Pools[1]},
+		{"http://www.example.com/self", lb},
+		{"http://www.example.com/", lb},
+	}
+	for _, test := range tests {
+		if got := lb.route(httptest.NewRequest("GET", test.target, nil)); got != test.want {
+			t.Errorf("route(%s) = %s, want %s", test.target, got.Name, test.want.Name)
+		}
+	}
+
+	lb.Routes = []Route{{Path: "/", Pool: "missing"}}
+	if err := lb.initRoutes(); err == nil {
+		t.Fatal("initRoutes accepted an unknown pool")
+	}
+}
+
+// TestRoundTripSourceHashFailover - http重试时跳过已经失败的后端
+func TestRoundTripSourceHashFailover(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	lb := newTestLB(t, AlgorithmSourceHash, 1, 1)
+	lb.Backends[0].Address = closedAddr(t)
+	lb.Backends[1].Address = server.Listener.Addr().(*net.TCPAddr)
+	lb.Retry = Retry{ConnectTimeout: time.Second, MaxAttempts: 2, Backoff: time.Millisecond}
+	client := clientFor(t, lb, lb.Backends[0])
+
+	transport := &proxyTransport{lb: lb, transport: &http.Transport{}}
+	defer transport.transport.CloseIdleConnections()
+	request := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	request.URL.Scheme = "http"
+	request = request.WithContext(context.WithValue(request.Context(), proxyContextKey{}, &proxyRequest{pool: lb, client: client}))
+	response, err := transport.RoundTrip(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", response.StatusCode)
+	}
+	if lb.Backends[0].failures != 1 {
+		t.Fatalf("backend a failures = %d, want 1", lb.Backends[0].failures)
+	}
+}
+
+// startHTTPLB - 启动7层负载均衡, 返回访问地址
+func startHTTPLB(t *testing.T, lb *LoadBalancer) string {
+	t.Helper()
+	lb.Type = "http"
+	lb.BindAddress = closedAddr(t)
+	manager := NewLBManager()
+	if err := manager.AddLoadBalancer(lb); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(manager.StopAll)
+	waitListening(t, lb.BindAddress.String(), true)
+	return "http://" + lb.BindAddress.String()
+}
+
+func TestHTTPForwardedHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Got-Forwarded-Host", r.Header.Get("X-Forwarded-Host"))
+		w.Header().Set("Got-Forwarded-Proto", r.Header.Get("X-Forwarded-Proto"))
+	}))
+	defer server.Close()
+	lb := newTestLB(t, "", 1)
+	lb.Backends[0].Address = server.Listener.Addr().(*net.TCPAddr)
+	url := startHTTPLB(t, lb)
+
+	request, err := http.NewRequest(http.MethodGet, url+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Host = "www.example.com"
+	// 客户端伪造的值被覆盖
+	request.Header.Set("X-Forwarded-Host", "evil.com")
+	request.Header.Set("X-Forwarded-Proto", "https")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if host := response.Header.Get("Got-Forwarded-Host"); host != "www.example.com" {
+		t.Errorf("X-Forwarded-Host = %q, want www.example.com", host)
+	}
+	if proto := response.Header.Get("Got-Forwarded-Proto"); proto != "http" {
+		t.Errorf("X-Forwarded-Proto = %q, want http", proto)
+	}
+}
+
+// TestHTTPRetryIdempotent - 只重试幂等且没有请求体的请求
+func TestHTTPRetryIdempotent(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+	// 轮询每次都先选择不可用的后端a
+	lb := newTestLB(t, "", 1, 1)
+	lb.Retry = Retry{ConnectTimeout: time.Second, MaxAttempts: 2, Backoff: time.Millisecond}
+	dead := lb.Backends[0]
+	dead.Address = closedAddr(t)
+	lb.Backends[1].Address = server.Listener.Addr().(*net.TCPAddr)
+	url := startHTTPLB(t, lb)
+
+	response, err := http.Get(url + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("GET status = %d, want 200", response.StatusCode)
+	}
+	response, err = http.Post(url+"/", "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadGateway {
+		t.Fatalf("POST status = %d, want 502", response.StatusCode)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Fatalf("backend requests = %d, want 1", got)
+	}
+	if dead.failures != 2 {
+		t.Fatalf("dead backend failures = %d, want 2", dead.failures)
+	}
+}
+
+func TestHTTPErrorStatus(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	tests := []struct {
+		name    string
+		setup   func(lb *LoadBalancer)
+		status  int
+		reasons []string
+	}{
+		// 没有健康的后端
+		{"no backend", func(lb *LoadBalancer) { lb.Backends[0].SetFailing(true) }, http.StatusServiceUnavailable, []string{FailureNoBackend}},
+		// 请求超时
+		{"timeout", func(lb *LoadBalancer) { lb.HTTP.Timeout = 100 * time.Millisecond }, http.StatusGatewayTimeout, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lb := newTestLB(t, "", 1)
+			lb.Backends[0].Address = slow.Listener.Addr().(*net.TCPAddr)
+			var reasons []string
+			lb.OnConnectFailure = func(_ *LoadBalancer, reason string) {
+				reasons = append(reasons, reason)
+			}
+			test.setup(lb)
+			url := startHTTPLB(t, lb)
+
+			response, err := http.Get(url + "/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != test.status {
+				t.Fatalf("status = %d, want %d", response.StatusCode, test.status)
+			}
+			if strings.Join(reasons, ",") != strings.Join(test.reasons, ",") {
+				t.Fatalf("failures = %v, want %v", reasons, test.reasons)
+			}
+		})
+	}
+}
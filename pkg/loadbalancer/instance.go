@@ -7,12 +7,14 @@ import (
 	"keep-vip/pkg/zlog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type LBInstance struct {
 	stop         chan bool
 	stopped      chan bool
+	draining     int32 // 1为排空: 关闭监听, 不再接受新连接, 已有连接继续转发
 	LoadBalancer *LoadBalancer
 }
 
@@ -25,9 +27,31 @@ func (li *LBInstance) startTCP() error {
 		for {
 			select {
 			case <-li.stop:
-				listen.Close()
+				if listen != nil {
+					listen.Close()
+				}
 				close(li.stopped)
+				return
 			default:
+				// 排空时关闭监听, 恢复后重新监听
+				if atomic.LoadInt32(&li.draining) == 1 {
+					if listen != nil {
+						listen.Close()
+						listen = nil
+						zlog.Info(fmt.Sprintf("Load Balancer instance [%s] is draining", li.LoadBalancer.Name))
+					}
+					time.Sleep(200 * time.Millisecond)
+					continue
+				}
+				if listen == nil {
+					if listen, err = net.ListenTCP("tcp", li.LoadBalancer.BindAddress); err != nil {
+						zlog.Error(errors.WithStack(err))
+						listen = nil
+						time.Sleep(200 * time.Millisecond)
+						continue
+					}
+					zlog.Info(fmt.Sprintf("Load Balancer instance [%s] resumed", li.LoadBalancer.Name))
+				}
 				if err = listen.SetDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
 					zlog.Error(errors.Errorf("Error setting TCP deadline [%v]", err))
 				}
@@ -38,6 +62,7 @@ func (li *LBInstance) startTCP() error {
 					} else if err != io.EOF {
 						zlog.Error(errors.Errorf("TCP Accept error [%s]", err))
 					}
+					continue
 				}
 				go tcpConnect(fd, li.LoadBalancer)
 			}
@@ -46,6 +71,15 @@ func (li *LBInstance) startTCP() error {
 	return nil
 }
 
+// Drain - 设置是否排空
+func (li *LBInstance) Drain(draining bool) {
+	var value int32
+	if draining {
+		value = 1
+	}
+	atomic.StoreInt32(&li.draining, value)
+}
+
 func (li *LBInstance) Stop() {
 	close(li.stop)
 
@@ -56,28 +90,18 @@ func (li *LBInstance) Stop() {
 func tcpConnect(frontend net.Conn, lb *LoadBalancer) {
 	defer frontend.Close()
 
-	// 设置超时时间
-	dialer := net.Dialer{Timeout: time.Millisecond * 500}
-
-	// 获取后端地址
-	var endpoint net.Conn
-	for {
-		backend, err := lb.ReturnBackend()
-		if err != nil {
-			zlog.Error(err)
-			return
-		}
-		// 拨号
-		endpoint, err = dialer.Dial("tcp", backend.String())
-		if err != nil {
-			zlog.Warn(fmt.Sprintf("[%s]---X [FAILED] X-->[%s]", frontend.RemoteAddr(), backend.String()))
-			zlog.Error(err)
-		} else {
-			zlog.Debug(fmt.Sprintf("[%s]--->[ACCEPT]--->[%s]", frontend.RemoteAddr(), backend.String()))
-			defer endpoint.Close()
-			break
+	endpoint, backend, reason := dialBackend(frontend.RemoteAddr(), lb)
+	if endpoint == nil {
+		zlog.Warn(fmt.Sprintf("[%s]---X [CLOSED] X-->[%s] %s", frontend.RemoteAddr(), lb.Name, reason))
+		if lb.OnConnectFailure != nil {
+			lb.OnConnectFailure(lb, reason)
 		}
+		return
 	}
+	zlog.Debug(fmt.Sprintf("[%s]--->[ACCEPT]--->[%s]", frontend.RemoteAddr(), backend.Address.String()))
+	atomic.AddInt64(&backend.connections, 1)
+	defer atomic.AddInt64(&backend.connections, -1)
+	defer endpoint.Close()
 
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
@@ -94,3 +118,43 @@ func tcpConnect(frontend net.Conn, lb *LoadBalancer) {
 	}
 	wg.Wait()
 }
+
+// dialBackend - 按重试策略拨号后端, 失败时返回失败原因
+func dialBackend(client net.Addr, lb *LoadBalancer) (net.Conn, *Backend, string) {
+	retry := lb.Retry
+	if retry.MaxAttempts < 1 {
+		retry.MaxAttempts = 1
+	}
+	var deadline time.Time
+	if retry.Deadline > 0 {
+		deadline = time.Now().Add(retry.Deadline)
+	}
+	backoff := retry.Backoff
+	tried := make(map[*Backend]bool)
+	for attempt := 1; ; attempt++ {
+		backend, err := lb.returnBackend(client, tried)
+		if err != nil {
+			zlog.Debug(err.Error())
+			return nil, nil, FailureNoBackend
+		}
+		// 单次拨号不超过总时间
+		dialer := net.Dialer{Timeout: retry.ConnectTimeout, Deadline: deadline}
+		endpoint, err := dialer.Dial("tcp", backend.Address.String())
+		if err == nil {
+			backend.reportSuccess()
+			return endpoint, backend, ""
+		}
+		zlog.Debug(fmt.Sprintf("[%s]---X [FAILED] X-->[%s] attempt %d/%d: %v",
+			client, backend.Address.String(), attempt, retry.MaxAttempts, err))
+		backend.reportFailure(lb)
+		tried[backend] = true
+		if attempt >= retry.MaxAttempts {
+			return nil, nil, FailureAttempts
+		}
+		if !deadline.IsZero() && time.Now().Add(backoff).After(deadline) {
+			return nil, nil, FailureDeadline
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
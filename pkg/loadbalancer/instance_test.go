@@ -0,0 +1,188 @@
+package loadbalancer
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// closedAddr - 返回一个没有监听的本地地址, 拨号立即被拒绝
+func closedAddr(t *testing.T) *net.TCPAddr {
+	t.Helper()
+	listen, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listen.Addr().(*net.TCPAddr)
+	listen.Close()
+	return addr
+}
+
+func TestDialBackendNoBackend(t *testing.T) {
+	lb := newTestLB(t, "", 1)
+	lb.Backends[0].SetFailing(true)
+	conn, backend, reason := dialBackend(nil, lb)
+	if conn != nil || backend != nil || reason != FailureNoBackend {
+		t.Fatalf("dialBackend = %v, %v, %q, want %q", conn, backend, reason, FailureNoBackend)
+	}
+}
+
+func TestDialBackendAttempts(t *testing.T) {
+	lb := newTestLB(t, "", 1, 1)
+	for _, backend := range lb.Backends {
+		backend.Address = closedAddr(t)
+	}
+	lb.Retry = Retry{ConnectTimeout: time.Second, MaxAttempts: 3, Backoff: 10 * time.Millisecond}
+	start := time.Now()
+	conn, _, reason := dialBackend(nil, lb)
+	if conn != nil || reason != FailureAttempts {
+		t.Fatalf("dialBackend = %v, %q, want %q", conn, reason, FailureAttempts)
+	}
+	// 两次退避: 10ms + 20ms
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Fatalf("dialBackend returned after %s, backoff not applied", elapsed)
+	}
+	// 轮询选择: a两次, b一次
+	if lb.Backends[0].failures != 2 || lb.Backends[1].failures != 1 {
+		t.Fatalf("failures = %d/%d, want 2/1", lb.Backends[0].failures, lb.Backends[1].failures)
+	}
+
+	// 小于1时只尝试一次
+	lb.Retry.MaxAttempts = 0
+	if _, _, reason := dialBackend(nil, lb); reason != FailureAttempts {
+		t.Fatalf("reason = %q, want %q", reason, FailureAttempts)
+	}
+	if lb.Backends[1].failures != 2 {
+		t.Fatalf("failures = %d, want 2", lb.Backends[1].failures)
+	}
+}
+
+func TestDialBackendDeadline(t *testing.T) {
+	lb := newTestLB(t, "", 1)
+	lb.Backends[0].Address = closedAddr(t)
+	lb.Retry = Retry{ConnectTimeout: time.Second, MaxAttempts: 10, Backoff: 40 * time.Millisecond, Deadline: 100 * time.Millisecond}
+	start := time.Now()
+	_, _, reason := dialBackend(nil, lb)
+	if reason != FailureDeadline {
+		t.Fatalf("reason = %q, want %q", reason, FailureDeadline)
+	}
+	// 40ms后第二次尝试, 下一次退避80ms超过总时间
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("dialBackend returned after %s, exceeded deadline", elapsed)
+	}
+	if lb.Backends[0].failures != 2 {
+		t.Fatalf("failures = %d, want 2", lb.Backends[0].failures)
+	}
+}
+
+func TestDialBackendRetrySuccess(t *testing.T) {
+	listen, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listen.Close()
+	lb := newTestLB(t, "", 1, 1)
+	lb.Backends[0].Address = closedAddr(t)
+	lb.Backends[1].Address = listen.Addr().(*net.TCPAddr)
+	lb.Backends[1].failures = 1
+	lb.Retry = Retry{ConnectTimeout: time.Second, MaxAttempts: 2, Backoff: time.Millisecond}
+	conn, backend, reason := dialBackend(nil, lb)
+	if conn == nil || reason != "" {
+		t.Fatalf("dialBackend = %v, %q, want connection", conn, reason)
+	}
+	defer conn.Close()
+	if backend != lb.Backends[1] {
+		t.Fatalf("backend = %s, want b", backend.Name)
+	}
+	// 失败的后端计数, 成功的后端清零
+	if lb.Backends[0].failures != 1 || lb.Backends[1].failures != 0 {
+		t.Fatalf("failures = %d/%d, want 1/0", lb.Backends[0].failures, lb.Backends[1].failures)
+	}
+}
+
+// waitListening - 等待地址开始或停止监听
+func waitListening(t *testing.T, addr string, listening bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if conn != nil {
+			conn.Close()
+		}
+		if (err == nil) == listening {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s listening = %v, want %v", addr, err == nil, listening)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	for _, lbType := range []string{"tcp", "http"} {
+		t.Run(lbType, func(t *testing.T) {
+			lb := newTestLB(t, "", 1)
+			lb.Type = lbType
+			lb.BindAddress = closedAddr(t)
+			manager := NewLBManager()
+			if err := manager.AddLoadBalancer(lb); err != nil {
+				t.Fatal(err)
+			}
+			defer manager.StopAll()
+			addr := lb.BindAddress.String()
+			waitListening(t, addr, true)
+
+			// 排空时关闭监听, 恢复后重新监听
+			manager.DrainAll(true)
+			waitListening(t, addr, false)
+			manager.DrainAll(false)
+			waitListening(t, addr, true)
+		})
+	}
+}
+
+// clientFor - 返回源地址哈希选择指定后端的客户端地址
+func clientFor(t *testing.T, lb *LoadBalancer, want *Backend) net.Addr {
+	t.Helper()
+	for i := 1; i < 1000; i++ {
+		client := &net.TCPAddr{IP: net.IPv4(10, 0, byte(i>>8), byte(i)), Port: 40000}
+		if backend, _ := lb.ReturnBackend(client); backend == want {
+			return client
+		}
+	}
+	t.Fatalf("no client hashed to backend %s", want.Name)
+	return nil
+}
+
+// TestDialBackendSourceHashFailover - 源地址哈希重试时跳过已经失败的后端, 不依赖被动检查摘除
+func TestDialBackendSourceHashFailover(t *testing.T) {
+	listen, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listen.Close()
+	lb := newTestLB(t, AlgorithmSourceHash, 1, 1)
+	lb.Backends[0].Address = closedAddr(t)
+	lb.Backends[1].Address = listen.Addr().(*net.TCPAddr)
+	lb.Retry = Retry{ConnectTimeout: time.Second, MaxAttempts: 2, Backoff: time.Millisecond}
+	client := clientFor(t, lb, lb.Backends[0])
+
+	for i := 0; i < 3; i++ {
+		conn, backend, reason := dialBackend(client, lb)
+		if conn == nil {
+			t.Fatalf("dialBackend failed: %s", reason)
+		}
+		conn.Close()
+		if backend != lb.Backends[1] {
+			t.Fatalf("backend = %s, want b", backend.Name)
+		}
+	}
+	// 没有配置被动检查, 失败的后端没有被摘除, 客户端仍然先选择它
+	if lb.Backends[0].Ejected() {
+		t.Fatal("backend a was ejected without passive checks")
+	}
+	if backend, _ := lb.ReturnBackend(client); backend != lb.Backends[0] {
+		t.Fatalf("client hashed to %s, want a", backend.Name)
+	}
+}
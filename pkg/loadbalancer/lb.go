@@ -1,37 +1,173 @@
 package loadbalancer
 
 import (
+	"fmt"
 	"github.com/pkg/errors"
+	"keep-vip/pkg/zlog"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type LoadBalancer struct {
 	Name        string
 	BindAddress *net.TCPAddr
 	Type        string
+	Algorithm   string // roundrobin|leastconn|p2c|sourcehash(默认:roundrobin)
 	Backends    []*Backend
+	Passive     Passive
+	Retry       Retry
+	IdleTimeout time.Duration // udp会话空闲超时
+	MaxFlows    int           // udp会话数上限, 达到上限时不创建新会话, 0不限制
+	HTTP        HTTPOptions
+	Routes      []Route
+	Pools       []*LoadBalancer // http路由的后端池
+	// OnConnectFailure - 所有重试都失败, 客户端连接被关闭时调用, 用于监控
+	OnConnectFailure func(lb *LoadBalancer, reason string)
+
+	selector selector
+}
+
+// 客户端连接失败原因
+const (
+	FailureNoBackend = "no_backend" // 没有健康的后端
+	FailureAttempts  = "attempts"   // 达到最大尝试次数
+	FailureDeadline  = "deadline"   // 超过总时间
+	FailureFlowLimit = "flow_limit" // udp会话数达到上限
+)
+
+// Retry - 拨号后端的重试策略
+type Retry struct {
+	ConnectTimeout time.Duration // 单次拨号超时
+	MaxAttempts    int           // 最大尝试次数, 小于1时为1
+	Backoff        time.Duration // 两次尝试的间隔, 每次翻倍
+	Deadline       time.Duration // 所有尝试的总时间, 0不限制
+}
+
+// Passive - 被动检查: 连续拨号失败达到次数后摘除后端, 摘除时间过后重新加入
+type Passive struct {
+	MaxFails  int // 0不摘除
+	EjectTime time.Duration
 }
 
 type Backend struct {
 	Name    string
 	Address *net.TCPAddr
+	Weight  int // 权重(默认:1)
+
+	connections  int64 // 当前连接数
+	mu           sync.Mutex
+	failing      bool // 主动检查状态为failing
+	failures     int  // 连续拨号失败次数
+	ejectedUntil time.Time
+}
+
+// SetFailing - 设置主动检查状态
+func (b *Backend) SetFailing(failing bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failing = failing
+}
+
+// Healthy - 主动检查不为failing且没有被摘除
+func (b *Backend) Healthy() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.failing && !time.Now().Before(b.ejectedUntil)
+}
+
+// Ejected - 是否被被动检查摘除
+func (b *Backend) Ejected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().Before(b.ejectedUntil)
+}
+
+// Connections - 当前连接数
+func (b *Backend) Connections() int64 {
+	return atomic.LoadInt64(&b.connections)
+}
+
+// weight - 权重, 小于1时为1
+func (b *Backend) weight() int {
+	if b.Weight < 1 {
+		return 1
+	}
+	return b.Weight
 }
 
-var backendIndex int // 保存前一个端点的索引
+// reportFailure - 记录拨号失败, 连续失败达到次数后摘除
+func (b *Backend) reportFailure(lb *LoadBalancer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if lb.Passive.MaxFails <= 0 || b.failures < lb.Passive.MaxFails {
+		return
+	}
+	b.failures = 0
+	b.ejectedUntil = time.Now().Add(lb.Passive.EjectTime)
+	zlog.Warn(fmt.Sprintf("Load Balancer [%s] ejected backend %s (%s) for %s after %d dial failures",
+		lb.Name, b.Name, b.Address, lb.Passive.EjectTime, lb.Passive.MaxFails))
+}
 
-func init() {
-	backendIndex = -1 // 初始索引
+// reportSuccess - 拨号成功, 清空连续失败次数
+func (b *Backend) reportSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
 }
 
-// ReturnBackend - 返回一个后端
-func (lb *LoadBalancer) ReturnBackend() (*net.TCPAddr, error) {
+// init - 根据算法创建后端选择器
+func (lb *LoadBalancer) init() error {
+	lb.Algorithm = strings.ToLower(lb.Algorithm)
+	if lb.Algorithm == "" {
+		lb.Algorithm = AlgorithmRoundRobin
+	}
+	for _, backend := range lb.Backends {
+		if backend.Weight < 1 {
+			backend.Weight = 1
+		}
+	}
+	selector, err := newSelector(lb.Algorithm, lb.Backends)
+	if err != nil {
+		return errors.WithMessagef(err, "Load Balancer [%s]", lb.Name)
+	}
+	lb.selector = selector
+	return lb.initRoutes()
+}
+
+// ReturnBackend - 根据算法返回一个健康的后端, client用于源地址哈希
+func (lb *LoadBalancer) ReturnBackend(client net.Addr) (*Backend, error) {
+	return lb.returnBackend(client, nil)
+}
+
+// returnBackend - 重试时跳过本次连接已经尝试过的后端, 否则源地址哈希每次都返回同一个后端.
+// 健康的后端都尝试过时从所有健康的后端中选择
+func (lb *LoadBalancer) returnBackend(client net.Addr, tried map[*Backend]bool) (*Backend, error) {
 	if len(lb.Backends) == 0 {
 		return nil, errors.New("No Backends configured")
 	}
-	if backendIndex < len(lb.Backends)-1 {
-		backendIndex++
-	} else {
-		backendIndex = 0
+	var healthy []*Backend
+	for _, backend := range lb.Backends {
+		if backend.Healthy() {
+			healthy = append(healthy, backend)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil, errors.Errorf("Load Balancer [%s] has no healthy backends", lb.Name)
+	}
+	if len(tried) > 0 {
+		var untried []*Backend
+		for _, backend := range healthy {
+			if !tried[backend] {
+				untried = append(untried, backend)
+			}
+		}
+		if len(untried) > 0 {
+			healthy = untried
+		}
 	}
-	return lb.Backends[backendIndex].Address, nil
+	return lb.selector.next(healthy, client), nil
 }
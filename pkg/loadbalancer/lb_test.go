@@ -0,0 +1,100 @@
+package loadbalancer
+
+import (
+	"keep-vip/pkg/zlog"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	zlog.NewZapLog("error", "console")
+	os.Exit(m.Run())
+}
+
+// newTestLB - 创建指定数量后端的负载均衡, 后端地址为127.0.0.1:10001开始
+func newTestLB(t *testing.T, algorithm string, weights ...int) *LoadBalancer {
+	t.Helper()
+	lb := &LoadBalancer{Name: "test", Algorithm: algorithm}
+	for i, weight := range weights {
+		lb.Backends = append(lb.Backends, &Backend{
+			Name:    string(rune('a' + i)),
+			Address: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10001 + i},
+			Weight:  weight,
+		})
+	}
+	if err := lb.init(); err != nil {
+		t.Fatal(err)
+	}
+	return lb
+}
+
+func TestPassiveEjection(t *testing.T) {
+	lb := newTestLB(t, "", 1)
+	lb.Passive = Passive{MaxFails: 2, EjectTime: 50 * time.Millisecond}
+	backend := lb.Backends[0]
+
+	backend.reportFailure(lb)
+	if !backend.Healthy() || backend.Ejected() {
+		t.Fatal("backend ejected before reaching max fails")
+	}
+	// 成功后重新计数
+	backend.reportSuccess()
+	backend.reportFailure(lb)
+	if backend.Ejected() {
+		t.Fatal("failures were not reset by a successful dial")
+	}
+	backend.reportFailure(lb)
+	if !backend.Ejected() || backend.Healthy() {
+		t.Fatal("backend not ejected after max fails")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if backend.Ejected() || !backend.Healthy() {
+		t.Fatal("backend still ejected after eject time")
+	}
+}
+
+func TestPassiveDisabled(t *testing.T) {
+	lb := newTestLB(t, "", 1)
+	backend := lb.Backends[0]
+	for i := 0; i < 10; i++ {
+		backend.reportFailure(lb)
+	}
+	if backend.Ejected() {
+		t.Fatal("backend ejected with max fails 0")
+	}
+}
+
+func TestReturnBackendSkipsUnhealthy(t *testing.T) {
+	lb := newTestLB(t, "", 1, 1, 1)
+	lb.Passive = Passive{MaxFails: 1, EjectTime: time.Minute}
+	lb.Backends[0].SetFailing(true)
+	lb.Backends[1].reportFailure(lb)
+	client := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 40000}
+	for i := 0; i < 10; i++ {
+		backend, err := lb.ReturnBackend(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if backend != lb.Backends[2] {
+			t.Fatalf("ReturnBackend = %s, want c", backend.Name)
+		}
+	}
+
+	lb.Backends[2].SetFailing(true)
+	if _, err := lb.ReturnBackend(client); err == nil {
+		t.Fatal("ReturnBackend returned a backend when all are unhealthy")
+	}
+	lb.Backends[0].SetFailing(false)
+	if backend, err := lb.ReturnBackend(client); err != nil || backend != lb.Backends[0] {
+		t.Fatalf("ReturnBackend = %v, %v, want recovered backend a", backend, err)
+	}
+}
+
+func TestReturnBackendNoBackends(t *testing.T) {
+	lb := newTestLB(t, "")
+	if _, err := lb.ReturnBackend(&net.TCPAddr{}); err == nil {
+		t.Fatal("ReturnBackend returned a backend without backends configured")
+	}
+}
@@ -14,6 +14,9 @@ func NewLBManager() LBManager {
 }
 
 func (lm *LBManager) AddLoadBalancer(lb *LoadBalancer) error {
+	if err := lb.init(); err != nil {
+		return err
+	}
 	lbInstance := &LBInstance{
 		stop:         make(chan bool, 1),
 		stopped:      make(chan bool, 1),
@@ -24,6 +27,14 @@ func (lm *LBManager) AddLoadBalancer(lb *LoadBalancer) error {
 		if err := lbInstance.startTCP(); err != nil {
 			return err
 		}
+	case "http":
+		if err := lbInstance.startHTTP(); err != nil {
+			return err
+		}
+	case "udp":
+		if err := lbInstance.startUDP(); err != nil {
+			return err
+		}
 	default:
 		return errors.Errorf(
 			"Add LoadBalancer %s the protocol type is not supported: %s",
@@ -35,6 +46,13 @@ func (lm *LBManager) AddLoadBalancer(lb *LoadBalancer) error {
 	return nil
 }
 
+// DrainAll - 设置所有负载均衡是否排空
+func (lm *LBManager) DrainAll(draining bool) {
+	for _, lb := range lm.LBInstances {
+		lb.Drain(draining)
+	}
+}
+
 func (lm *LBManager) StopAll() {
 	for _, lb := range lm.LBInstances {
 		lb.Stop()
@@ -0,0 +1,262 @@
+package loadbalancer
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"keep-vip/pkg/zlog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// udpBufferSize - UDP报文最大长度
+const udpBufferSize = 65535
+
+// udpFlow - 一个客户端到后端的UDP会话, 空闲超时后删除
+type udpFlow struct {
+	client     *net.UDPAddr
+	local      net.IP // 客户端报文的目的地址, 回复时作为源地址
+	backend    *Backend
+	conn       *net.UDPConn // 连接到后端的socket, 接收后端的回复
+	lastActive int64        // 最近一次收发报文的时间, UnixNano
+	closeOnce  sync.Once
+}
+
+func (f *udpFlow) touch() {
+	atomic.StoreInt64(&f.lastActive, time.Now().UnixNano())
+}
+
+func (f *udpFlow) idle(timeout time.Duration) bool {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&f.lastActive))) >= timeout
+}
+
+func (f *udpFlow) close() {
+	f.closeOnce.Do(func() {
+		f.conn.Close()
+		atomic.AddInt64(&f.backend.connections, -1)
+	})
+}
+
+// udpFlows - 客户端会话表, 以客户端地址和目的地址为key
+type udpFlows struct {
+	mu    sync.Mutex
+	flows map[string]*udpFlow
+}
+
+// toUDPAddr - 负载均衡地址统一使用TCPAddr保存
+func toUDPAddr(addr *net.TCPAddr) *net.UDPAddr {
+	return &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone}
+}
+
+// udpListener - 监听socket, 接收时获取报文的目的地址, 回复时指定源地址.
+// 监听0.0.0.0时回复的源地址必须是客户端访问的VIP, 否则客户端不接受回复
+type udpListener struct {
+	conn *net.UDPConn
+	v4   *ipv4.PacketConn
+	v6   *ipv6.PacketConn
+}
+
+func listenUDP(bind *net.TCPAddr) (*udpListener, error) {
+	network := "udp6"
+	if bind.IP == nil || bind.IP.To4() != nil {
+		network = "udp4"
+	}
+	conn, err := net.ListenUDP(network, toUDPAddr(bind))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	listen := &udpListener{conn: conn}
+	if network == "udp4" {
+		listen.v4 = ipv4.NewPacketConn(conn)
+		err = listen.v4.SetControlMessage(ipv4.FlagDst, true)
+	} else {
+		listen.v6 = ipv6.NewPacketConn(conn)
+		err = listen.v6.SetControlMessage(ipv6.FlagDst, true)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, errors.WithStack(err)
+	}
+	return listen, nil
+}
+
+// read - 返回报文长度, 客户端地址和报文的目的地址
+func (l *udpListener) read(buf []byte) (int, *net.UDPAddr, net.IP, error) {
+	var (
+		n   int
+		src net.Addr
+		dst net.IP
+		err error
+	)
+	if l.v4 != nil {
+		var cm *ipv4.ControlMessage
+		if n, cm, src, err = l.v4.ReadFrom(buf); cm != nil {
+			dst = cm.Dst
+		}
+	} else {
+		var cm *ipv6.ControlMessage
+		if n, cm, src, err = l.v6.ReadFrom(buf); cm != nil {
+			dst = cm.Dst
+		}
+	}
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	client, ok := src.(*net.UDPAddr)
+	if !ok {
+		return 0, nil, nil, errors.Errorf("unexpected UDP source address %v", src)
+	}
+	return n, client, dst, nil
+}
+
+// write - 以local为源地址发送报文给客户端, local为空时由内核选择
+func (l *udpListener) write(buf []byte, client *net.UDPAddr, local net.IP) error {
+	var err error
+	if l.v4 != nil {
+		_, err = l.v4.WriteTo(buf, &ipv4.ControlMessage{Src: local}, client)
+	} else {
+		_, err = l.v6.WriteTo(buf, &ipv6.ControlMessage{Src: local}, client)
+	}
+	return err
+}
+
+func (li *LBInstance) startUDP() error {
+	listen, err := listenUDP(li.LoadBalancer.BindAddress)
+	if err != nil {
+		return err
+	}
+	table := &udpFlows{flows: make(map[string]*udpFlow)}
+	go func() {
+		buf := make([]byte, udpBufferSize)
+		for {
+			select {
+			case <-li.stop:
+				listen.conn.Close()
+				table.mu.Lock()
+				for key, flow := range table.flows {
+					flow.close()
+					delete(table.flows, key)
+				}
+				table.mu.Unlock()
+				close(li.stopped)
+				return
+			default:
+				if err := listen.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+					zlog.Error(errors.Errorf("Error setting UDP deadline [%v]", err))
+				}
+				n, client, local, err := listen.read(buf)
+				if err != nil {
+					if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+						continue
+					}
+					zlog.Error(errors.Errorf("UDP Read error [%s]", err))
+					continue
+				}
+				flow := li.udpFlow(listen, table, client, local)
+				if flow == nil {
+					continue
+				}
+				flow.touch()
+				if _, err := flow.conn.Write(buf[:n]); err != nil {
+					zlog.Debug(fmt.Sprintf("[%s]---X [FAILED] X-->[%s] %v", client, flow.backend.Address.String(), err))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// udpFlow - 返回客户端的会话, 不存在或者后端不健康时选择后端创建新会话. 排空时不创建新会话
+func (li *LBInstance) udpFlow(listen *udpListener, table *udpFlows, client *net.UDPAddr, local net.IP) *udpFlow {
+	lb := li.LoadBalancer
+	key := client.String() + "->" + local.String()
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	if flow, ok := table.flows[key]; ok {
+		if flow.backend.Healthy() {
+			return flow
+		}
+		flow.close()
+		delete(table.flows, key)
+	}
+	if atomic.LoadInt32(&li.draining) == 1 {
+		return nil
+	}
+	// 每个会话占用一个socket和goroutine, 达到上限时丢弃新客户端的报文
+	if lb.MaxFlows > 0 && len(table.flows) >= lb.MaxFlows {
+		zlog.Debug(fmt.Sprintf("[%s]---X [FLOW LIMIT] X-->[%s] %d flows", client, lb.Name, len(table.flows)))
+		if lb.OnConnectFailure != nil {
+			lb.OnConnectFailure(lb, FailureFlowLimit)
+		}
+		return nil
+	}
+	backend, err := lb.ReturnBackend(client)
+	if err != nil {
+		zlog.Debug(err.Error())
+		if lb.OnConnectFailure != nil {
+			lb.OnConnectFailure(lb, FailureNoBackend)
+		}
+		return nil
+	}
+	conn, err := net.DialUDP("udp", nil, toUDPAddr(backend.Address))
+	if err != nil {
+		zlog.Debug(fmt.Sprintf("[%s]---X [FAILED] X-->[%s] %v", client, backend.Address.String(), err))
+		backend.reportFailure(lb)
+		if lb.OnConnectFailure != nil {
+			lb.OnConnectFailure(lb, FailureAttempts)
+		}
+		return nil
+	}
+	zlog.Debug(fmt.Sprintf("[%s]--->[ACCEPT]--->[%s]", client, backend.Address.String()))
+	atomic.AddInt64(&backend.connections, 1)
+	flow := &udpFlow{client: client, local: local, backend: backend, conn: conn}
+	flow.touch()
+	table.flows[key] = flow
+	go li.udpReply(listen, table, key, flow)
+	return flow
+}
+
+// udpReply - 转发后端的回复给客户端, 会话空闲超时后删除
+func (li *LBInstance) udpReply(listen *udpListener, table *udpFlows, key string, flow *udpFlow) {
+	lb := li.LoadBalancer
+	defer func() {
+		table.mu.Lock()
+		if table.flows[key] == flow {
+			delete(table.flows, key)
+		}
+		table.mu.Unlock()
+		flow.close()
+	}()
+	buf := make([]byte, udpBufferSize)
+	for {
+		if err := flow.conn.SetReadDeadline(time.Now().Add(lb.IdleTimeout)); err != nil {
+			return
+		}
+		n, err := flow.conn.Read(buf)
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				if flow.idle(lb.IdleTimeout) {
+					zlog.Debug(fmt.Sprintf("[%s]---[IDLE]---[%s]", flow.client, flow.backend.Address.String()))
+					return
+				}
+				continue
+			}
+			// 会话已关闭
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// 后端返回ICMP端口不可达
+			zlog.Debug(fmt.Sprintf("[%s]---X [FAILED] X-->[%s] %v", flow.client, flow.backend.Address.String(), err))
+			flow.backend.reportFailure(lb)
+			return
+		}
+		flow.backend.reportSuccess()
+		flow.touch()
+		if err := listen.write(buf[:n], flow.client, flow.local); err != nil {
+			zlog.Debug(fmt.Sprintf("[%s]<--X [FAILED] X---[%s] %v", flow.client, flow.backend.Address.String(), err))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package loadbalancer
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// udpEcho - 本地UDP回显服务
+func udpEcho(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, udpBufferSize)
+		for {
+			n, client, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(buf[:n], client)
+		}
+	}()
+	return conn
+}
+
+func TestUDPReplySource(t *testing.T) {
+	echo := udpEcho(t)
+	defer echo.Close()
+	free, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := free.LocalAddr().(*net.UDPAddr).Port
+	free.Close()
+
+	lb := newTestLB(t, "", 1)
+	lb.BindAddress = &net.TCPAddr{IP: net.IPv4zero, Port: port}
+	lb.Backends[0].Address = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: echo.LocalAddr().(*net.UDPAddr).Port}
+	lb.IdleTimeout = time.Second
+	li := &LBInstance{stop: make(chan bool), stopped: make(chan bool), LoadBalancer: lb}
+	if err := li.startUDP(); err != nil {
+		t.Fatal(err)
+	}
+	defer li.Stop()
+
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	buf := make([]byte, 64)
+	// 监听0.0.0.0时, 回复的源地址是客户端访问的地址而不是内核选择的地址
+	for _, ip := range []net.IP{net.IPv4(127, 0, 0, 2), net.IPv4(127, 0, 0, 3)} {
+		vip := &net.UDPAddr{IP: ip, Port: port}
+		if _, err := client.WriteToUDP([]byte("ping"), vip); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		n, from, err := client.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != "ping" || !from.IP.Equal(ip) || from.Port != port {
+			t.Fatalf("reply %q from %s, want ping from %s", buf[:n], from, vip)
+		}
+	}
+	// 同一客户端访问不同地址是不同的会话
+	if connections := lb.Backends[0].Connections(); connections != 2 {
+		t.Fatalf("connections = %d, want 2", connections)
+	}
+}
+
+func TestUDPMaxFlows(t *testing.T) {
+	echo := udpEcho(t)
+	defer echo.Close()
+	free, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vip := free.LocalAddr().(*net.UDPAddr)
+	free.Close()
+
+	lb := newTestLB(t, "", 1)
+	lb.BindAddress = &net.TCPAddr{IP: vip.IP, Port: vip.Port}
+	lb.Backends[0].Address = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: echo.LocalAddr().(*net.UDPAddr).Port}
+	lb.IdleTimeout = time.Second
+	lb.MaxFlows = 1
+	var mu sync.Mutex
+	var reasons []string
+	lb.OnConnectFailure = func(_ *LoadBalancer, reason string) {
+		mu.Lock()
+		defer mu.Unlock()
+		reasons = append(reasons, reason)
+	}
+	li := &LBInstance{stop: make(chan bool), stopped: make(chan bool), LoadBalancer: lb}
+	if err := li.startUDP(); err != nil {
+		t.Fatal(err)
+	}
+	defer li.Stop()
+
+	ping := func(client *net.UDPConn) error {
+		if _, err := client.WriteToUDP([]byte("ping"), vip); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.SetReadDeadline(time.Now().Add(200 * time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := client.ReadFromUDP(make([]byte, 64))
+		return err
+	}
+	first, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	if err := ping(first); err != nil {
+		t.Fatalf("first flow: %v", err)
+	}
+	// 达到上限后新客户端的报文被丢弃, 已有会话不受影响
+	if err := ping(second); err == nil {
+		t.Fatal("second flow got a reply over the limit")
+	}
+	if err := ping(first); err != nil {
+		t.Fatalf("existing flow: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reasons) != 1 || reasons[0] != FailureFlowLimit {
+		t.Fatalf("failures = %v, want [%s]", reasons, FailureFlowLimit)
+	}
+}
@@ -57,8 +57,14 @@ func (m *arpMessage) bytes() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// ARPSendGratuitous 通过指定网卡发送Gratuitous ARP消息
-func ARPSendGratuitous(address, ifaceName string) error {
+// ARPSendGratuitous 通过指定网卡发送Gratuitous ARP消息, netnsName不为空时在该网络命名空间中发送
+func ARPSendGratuitous(address, ifaceName, netnsName string) error {
+	return inNetns(netnsName, func() error {
+		return arpSendGratuitous(address, ifaceName)
+	})
+}
+
+func arpSendGratuitous(address, ifaceName string) error {
 	iface, err := net.InterfaceByName(ifaceName)
 	if err != nil {
 		return errors.Wrapf(err, "failed to get interface %s", ifaceName)
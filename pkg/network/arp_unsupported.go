@@ -6,6 +6,6 @@ package network
 import "fmt"
 
 // ARPSendGratuitous 只支持Linux, 所以返回错误
-func ARPSendGratuitous(address, ifaceName string) error {
+func ARPSendGratuitous(address, ifaceName, netnsName string) error {
 	return fmt.Errorf("unsupported on this OS")
 }
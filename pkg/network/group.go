@@ -0,0 +1,80 @@
+package network
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"keep-vip/pkg/zlog"
+)
+
+// VipGroup - VIP同步组, 组内VIP同时绑定、同时释放
+type VipGroup struct {
+	Name   string
+	Vips   []Vip
+	Checks []string // 跟踪的检查名称, 任意一个失败整组迁移
+}
+
+// AddVIP - 绑定组内所有VIP, 任意一个失败则回滚整组
+func (g *VipGroup) AddVIP() error {
+	for i, vip := range g.Vips {
+		if err := vip.AddVIP(); err != nil {
+			for _, added := range g.Vips[:i] {
+				if err := added.DeleteVIP(); err != nil {
+					zlog.Warn(err.Error())
+				}
+			}
+			return errors.WithMessagef(err, "sync group %s add vip %s failed", g.Name, vip.String())
+		}
+	}
+	return nil
+}
+
+// DeleteVIP - 释放组内所有VIP, 单个失败不影响其他VIP释放
+func (g *VipGroup) DeleteVIP() error {
+	var lastErr error
+	for _, vip := range g.Vips {
+		if err := vip.DeleteVIP(); err != nil {
+			zlog.Warn(err.Error())
+			lastErr = errors.WithMessagef(err, "sync group %s delete vip %s failed", g.Name, vip.String())
+		}
+	}
+	return lastErr
+}
+
+// SendGratuitous - 组内所有地址模式VIP广播Gratuitous ARP
+func (g *VipGroup) SendGratuitous() error {
+	var lastErr error
+	for _, vip := range g.Vips {
+		if vip.Mode() != ModeAddress {
+			continue
+		}
+		if err := ARPSendGratuitous(vip.String(), vip.Interface(), vip.Netns()); err != nil {
+			zlog.Warn(err.Error())
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// CheckLinks - 检查组内VIP所在网络接口, 任意一个DOWN则返回错误
+func (g *VipGroup) CheckLinks() error {
+	for _, vip := range g.Vips {
+		up, err := vip.IsLinkUp()
+		if err != nil {
+			return err
+		}
+		if !up {
+			return errors.New(fmt.Sprintf("interface %s of vip %s is down", vip.Interface(), vip.String()))
+		}
+	}
+	return nil
+}
+
+// Tracks - 同步组是否跟踪该检查
+func (g *VipGroup) Tracks(check string) bool {
+	for _, name := range g.Checks {
+		if name == check {
+			return true
+		}
+	}
+	return false
+}
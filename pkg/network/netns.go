@@ -0,0 +1,61 @@
+package network
+
+import (
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"runtime"
+)
+
+// newHandle - 创建指定网络命名空间的netlink句柄, name为空使用当前命名空间
+func newHandle(name string) (*netlink.Handle, error) {
+	if name == "" {
+		return &netlink.Handle{}, nil
+	}
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get netns %s", name)
+	}
+	defer ns.Close()
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create netlink handle in netns %s", name)
+	}
+	return handle, nil
+}
+
+// inNetns - 在指定网络命名空间中执行fn, name为空直接执行
+// fn在独立的goroutine中执行并锁定线程, 恢复命名空间失败时线程随goroutine退出销毁, 不影响其他goroutine
+func inNetns(name string, fn func() error) error {
+	if name == "" {
+		return fn()
+	}
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		origin, err := netns.Get()
+		if err != nil {
+			result <- errors.WithStack(err)
+			return
+		}
+		defer origin.Close()
+		target, err := netns.GetFromName(name)
+		if err != nil {
+			result <- errors.Wrapf(err, "failed to get netns %s", name)
+			return
+		}
+		defer target.Close()
+		if err := netns.Set(target); err != nil {
+			result <- errors.Wrapf(err, "failed to enter netns %s", name)
+			return
+		}
+		err = fn()
+		if restoreErr := netns.Set(origin); restoreErr != nil {
+			result <- errors.Wrap(restoreErr, "failed to restore netns")
+			return
+		}
+		runtime.UnlockOSThread()
+		result <- err
+	}()
+	return <-result
+}
@@ -0,0 +1,174 @@
+package network
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+	"keep-vip/pkg/zlog"
+	"net"
+)
+
+// RouteProtocol - keep-vip添加的路由协议号(ip route ... proto 123), 用于识别和清理残留路由
+const RouteProtocol = 123
+
+// VipRoute - 路由模式, Leader添加VIP主机路由(和策略路由), 由本机路由进程通过内核路由表发布
+type VipRoute struct {
+	route  *netlink.Route
+	rule   *netlink.Rule // 为nil时不添加策略路由
+	link   netlink.Link
+	handle *netlink.Handle
+	netns  string
+}
+
+// IsExist - 检查VIP路由是否存在
+func (v *VipRoute) IsExist() (bool, error) {
+	routes, err := v.handle.RouteListFiltered(netlink.FAMILY_V4, v.route,
+		netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL|netlink.RT_FILTER_OIF|netlink.RT_FILTER_DST)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return len(routes) > 0, nil
+}
+
+// ruleIsExist - 检查VIP策略路由是否存在
+func (v *VipRoute) ruleIsExist() (bool, error) {
+	if v.rule == nil {
+		return false, nil
+	}
+	rules, err := v.handle.RuleList(netlink.FAMILY_V4)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	for _, rule := range rules {
+		if rule.Priority == v.rule.Priority && rule.Table == v.rule.Table &&
+			rule.Dst != nil && rule.Dst.String() == v.rule.Dst.String() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AddVIP - 添加VIP路由和策略路由
+func (v *VipRoute) AddVIP() error {
+	exist, err := v.IsExist()
+	if err != nil {
+		return err
+	}
+	if !exist {
+		zlog.Debug(fmt.Sprintf("Add vip route: %s dev %s table %d", v.route.Dst, v.Interface(), v.route.Table))
+		if err := v.handle.RouteAdd(v.route); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if v.rule == nil {
+		return nil
+	}
+	exist, err = v.ruleIsExist()
+	if err != nil {
+		return err
+	}
+	if !exist {
+		zlog.Debug(fmt.Sprintf("Add vip rule: %d to %s lookup %d", v.rule.Priority, v.rule.Dst, v.rule.Table))
+		if err := v.handle.RuleAdd(v.rule); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// DeleteVIP - 删除VIP策略路由和路由
+func (v *VipRoute) DeleteVIP() error {
+	exist, err := v.ruleIsExist()
+	if err != nil {
+		return err
+	}
+	if exist {
+		zlog.Debug(fmt.Sprintf("Delete vip rule: %d to %s lookup %d", v.rule.Priority, v.rule.Dst, v.rule.Table))
+		if err := v.handle.RuleDel(v.rule); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	exist, err = v.IsExist()
+	if err != nil {
+		return err
+	}
+	if exist {
+		zlog.Debug(fmt.Sprintf("Delete vip route: %s dev %s table %d", v.route.Dst, v.Interface(), v.route.Table))
+		if err := v.handle.RouteDel(v.route); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// IsLinkUp - 检查VIP路由出接口是否UP
+func (v *VipRoute) IsLinkUp() (bool, error) {
+	return linkIsUp(v.handle, v.link)
+}
+
+// Mode - 返回VIP模式
+func (v *VipRoute) Mode() string {
+	return ModeRoute
+}
+
+// String - 返回VIP地址
+func (v *VipRoute) String() string {
+	return v.route.Dst.IP.String()
+}
+
+// Interface - 返回网络接口名字
+func (v *VipRoute) Interface() string {
+	return v.link.Attrs().Name
+}
+
+// Netns - 返回网络接口所在的命名空间, 空字符串为当前命名空间
+func (v *VipRoute) Netns() string {
+	return v.netns
+}
+
+// NewVipRoute - 创建路由模式VIP, table为0时使用main表, rulePriority大于0时添加策略路由
+func NewVipRoute(vipAddr, iface, netnsName string, table, rulePriority int) (Vip, error) {
+	// 解析vip
+	ip := net.ParseIP(vipAddr)
+	if ip.To4() == nil {
+		return nil, errors.New(fmt.Sprintf("could not parse vip '%s'", vipAddr))
+	}
+	if table <= 0 {
+		table = unix.RT_TABLE_MAIN
+	}
+	dst := &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}
+
+	// 连接网卡
+	handle, err := newHandle(netnsName)
+	if err != nil {
+		return nil, err
+	}
+	link, err := handle.LinkByName(iface)
+	if err != nil {
+		handle.Delete()
+		return nil, errors.Wrapf(err, "failed to get interface %s in netns '%s'", iface, netnsName)
+	}
+
+	v := &VipRoute{
+		route: &netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Dst:       dst,
+			Scope:     netlink.SCOPE_LINK,
+			Protocol:  RouteProtocol,
+			Table:     table,
+		},
+		link:   link,
+		handle: handle,
+		netns:  netnsName,
+	}
+	if rulePriority > 0 {
+		rule := netlink.NewRule()
+		rule.Family = netlink.FAMILY_V4
+		rule.Dst = dst
+		rule.Table = table
+		rule.Priority = rulePriority
+		v.rule = rule
+	}
+	return v, nil
+}
@@ -0,0 +1,111 @@
+package network
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// AddressLabelSuffix - keep-vip添加的VIP地址标签后缀, 标签格式: <网卡名>:kv
+const AddressLabelSuffix = ":kv"
+
+// addressLabel - 地址标签必须以网卡名开头, 且不超过15个字符. 超长返回空字符串, 不打标签
+func addressLabel(iface string) string {
+	label := iface + AddressLabelSuffix
+	if len(label) > unix.IFNAMSIZ-1 {
+		return ""
+	}
+	return label
+}
+
+// CleanStaleVips - 删除网络命名空间中带有keep-vip标签的地址, keep-vip协议号的路由,
+// 以及vips中路由模式VIP优先级和路由表相同的/32策略路由, 返回已删除的地址
+func CleanStaleVips(netnsName string, vips []Vip) ([]string, error) {
+	handle, err := newHandle(netnsName)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Delete()
+
+	links, err := handle.LinkList()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var removed []string
+	for _, link := range links {
+		adders, err := handle.AddrList(link, netlink.FAMILY_V4)
+		if err != nil {
+			return removed, errors.WithStack(err)
+		}
+		for _, address := range adders {
+			address := address
+			if address.Label == "" || address.Label != addressLabel(link.Attrs().Name) {
+				continue
+			}
+			if err := handle.AddrDel(link, &address); err != nil {
+				return removed, errors.WithStack(err)
+			}
+			stale := fmt.Sprintf("%s dev %s", address.IPNet.String(), link.Attrs().Name)
+			if netnsName != "" {
+				stale += " netns " + netnsName
+			}
+			removed = append(removed, stale)
+		}
+	}
+
+	// 路由模式残留的路由, 遍历所有路由表
+	routes, err := handle.RouteListFiltered(netlink.FAMILY_V4, &netlink.Route{Protocol: RouteProtocol},
+		netlink.RT_FILTER_TABLE|netlink.RT_FILTER_PROTOCOL)
+	if err != nil {
+		return removed, errors.WithStack(err)
+	}
+	for _, route := range routes {
+		route := route
+		if err := handle.RouteDel(&route); err != nil {
+			return removed, errors.WithStack(err)
+		}
+		stale := fmt.Sprintf("route %s table %d", route.Dst, route.Table)
+		if netnsName != "" {
+			stale += " netns " + netnsName
+		}
+		removed = append(removed, stale)
+	}
+
+	// 路由模式残留的策略路由. 策略路由没有协议号, 按配置的优先级和路由表匹配
+	type ruleKey struct {
+		priority int
+		table    int
+	}
+	keys := make(map[ruleKey]bool)
+	for _, vip := range vips {
+		if v, ok := vip.(*VipRoute); ok && v.rule != nil && v.netns == netnsName {
+			keys[ruleKey{priority: v.rule.Priority, table: v.rule.Table}] = true
+		}
+	}
+	if len(keys) == 0 {
+		return removed, nil
+	}
+	rules, err := handle.RuleList(netlink.FAMILY_V4)
+	if err != nil {
+		return removed, errors.WithStack(err)
+	}
+	for _, rule := range rules {
+		rule := rule
+		if !keys[ruleKey{priority: rule.Priority, table: rule.Table}] || rule.Dst == nil {
+			continue
+		}
+		if ones, bits := rule.Dst.Mask.Size(); ones != 32 || bits != 32 {
+			continue
+		}
+		if err := handle.RuleDel(&rule); err != nil {
+			return removed, errors.WithStack(err)
+		}
+		stale := fmt.Sprintf("rule %d to %s lookup %d", rule.Priority, rule.Dst, rule.Table)
+		if netnsName != "" {
+			stale += " netns " + netnsName
+		}
+		removed = append(removed, stale)
+	}
+	return removed, nil
+}
@@ -9,17 +9,27 @@ import (
 	"net"
 )
 
+const (
+	ModeAddress = "address" // 地址模式, VIP添加到网络接口并广播ARP
+	ModeRoute   = "route"   // 路由模式, VIP以主机路由发布
+)
+
 type Vip interface {
 	IsExist() (bool, error)
 	AddVIP() error
 	DeleteVIP() error
+	IsLinkUp() (bool, error)
+	Mode() string
 	String() string
 	Interface() string
+	Netns() string
 }
 
 type VipInterface struct {
 	address *netlink.Addr
 	link    netlink.Link
+	handle  *netlink.Handle // 网络接口所在命名空间的netlink句柄
+	netns   string
 }
 
 // IsExist - 检查VIP是否存在
@@ -28,7 +38,7 @@ func (v *VipInterface) IsExist() (bool, error) {
 		return false, nil
 	}
 	// 获取网卡的IP地址列表
-	adders, err := netlink.AddrList(v.link, 0)
+	adders, err := v.handle.AddrList(v.link, 0)
 	if err != nil {
 		return false, errors.WithStack(err)
 	}
@@ -49,7 +59,7 @@ func (v *VipInterface) AddVIP() error {
 	// 不存在添加VIP
 	if !exist {
 		zlog.Debug("Add vip: " + v.String())
-		if err := netlink.AddrAdd(v.link, v.address); err != nil {
+		if err := v.handle.AddrAdd(v.link, v.address); err != nil {
 			return errors.WithStack(err)
 		}
 	}
@@ -65,13 +75,23 @@ func (v *VipInterface) DeleteVIP() error {
 	// 存在则删除VIP
 	if exist {
 		zlog.Debug("Delete vip: " + v.String())
-		if err := netlink.AddrDel(v.link, v.address); err != nil {
+		if err := v.handle.AddrDel(v.link, v.address); err != nil {
 			return errors.WithStack(err)
 		}
 	}
 	return nil
 }
 
+// IsLinkUp - 检查VIP所在网络接口是否UP
+func (v *VipInterface) IsLinkUp() (bool, error) {
+	return linkIsUp(v.handle, v.link)
+}
+
+// Mode - 返回VIP模式
+func (v *VipInterface) Mode() string {
+	return ModeAddress
+}
+
 // VIP - 返回VIP地址
 func (v *VipInterface) String() string {
 	return v.address.IP.String()
@@ -82,7 +102,27 @@ func (v *VipInterface) Interface() string {
 	return v.link.Attrs().Name
 }
 
-func NewVip(vipAddr, iface string) (Vip, error) {
+// Netns - 返回网络接口所在的命名空间, 空字符串为当前命名空间
+func (v *VipInterface) Netns() string {
+	return v.netns
+}
+
+// linkIsUp - 重新获取网络接口状态, 检查是否UP
+func linkIsUp(handle *netlink.Handle, link netlink.Link) (bool, error) {
+	current, err := handle.LinkByIndex(link.Attrs().Index)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	attrs := current.Attrs()
+	if attrs.Flags&net.FlagUp == 0 {
+		return false, nil
+	}
+	// lo、dummy等接口的OperState为unknown
+	return attrs.OperState == netlink.OperUp || attrs.OperState == netlink.OperUnknown, nil
+}
+
+// NewVip - netnsName不为空时, 网络接口查找和地址操作都在该网络命名空间中执行
+func NewVip(vipAddr, iface, netnsName string) (Vip, error) {
 	// 解析vip
 	if ip := net.ParseIP(vipAddr); ip.To4() == nil {
 		return nil, errors.New(fmt.Sprintf("could not parse vip '%s'", vipAddr))
@@ -96,13 +136,25 @@ func NewVip(vipAddr, iface string) (Vip, error) {
 	}
 
 	// 连接网卡
-	link, err := netlink.LinkByName(iface)
+	handle, err := newHandle(netnsName)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
+	}
+	link, err := handle.LinkByName(iface)
+	if err != nil {
+		handle.Delete()
+		return nil, errors.Wrapf(err, "failed to get interface %s in netns '%s'", iface, netnsName)
+	}
+	// 打上keep-vip标签, 异常退出后启动时清理残留的VIP
+	address.Label = addressLabel(link.Attrs().Name)
+	if address.Label == "" {
+		zlog.Warn(fmt.Sprintf("Interface name %s is too long to label vip %s, it will not be cleaned at startup", iface, vipAddr))
 	}
 
 	return &VipInterface{
 		address: address,
 		link:    link,
+		handle:  handle,
+		netns:   netnsName,
 	}, nil
 }
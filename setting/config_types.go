@@ -1,14 +1,26 @@
 package setting
 
 type config struct {
-	Cluster        string          // 集群名称
-	Interface      string          // 绑定到的网络接口(默认:First Adapter)
-	VIP            string          // VIP地址
-	ChecksInterval int             // 单位s, 发送Gratuitous ARP间隔
-	Prometheus     prometheus      // Prometheus
-	Checks         []check         // 检查端口
-	Members        []member        // 集群内成员
-	LoadBalancers  []loadBalancers // 负载均衡
+	Cluster         string          // 集群名称
+	Interface       string          // 绑定到的网络接口(默认:First Adapter)
+	VIP             string          // VIP地址
+	Netns           string          // 网络接口所在的命名空间(默认:当前命名空间)
+	Mode            string          // VIP模式: address|route(默认:address)
+	Route           route           // 路由模式配置
+	SyncGroups      []syncGroup     // VIP同步组
+	ChecksInterval  int             // 单位s, 发送Gratuitous ARP间隔
+	Prometheus      prometheus      // Prometheus
+	Admin           admin           // 管理接口
+	Firewall        firewall        // Leader节点nftables规则
+	Checks          []Check         // 检查端口
+	CheckGroups     []checkGroup    // 组合检查
+	MaintenanceFile string          // 维护文件, 存在时节点释放VIP, 不能成为Leader, 负载均衡不接受新连接
+	PlacementCheck  string          `mapstructure:"placement_check"` // 不为空时为放置模式: VIP绑定到该检查为passing的成员, 不绑定到Leader
+	Members         []member        // 集群内成员
+	ScoreMargin     int             // 成员分数至少高出多少才转移Leader(默认:1)
+	ScoreHold       int             // 单位s, 成员分数持续高出多久才转移Leader(默认:3个检查周期)
+	PeerToken       string          // 成员接口写操作(转发集群冻结)的共享密钥, 为空时只接受成员IP的请求
+	LoadBalancers   []loadBalancers // 负载均衡
 }
 
 type prometheus struct {
@@ -16,24 +28,194 @@ type prometheus struct {
 	Address string
 }
 
-type check struct {
-	Name     string
-	Address  string
-	Protocol string
-	Timeout  int
+type admin struct {
+	Enabled bool
+	Address string
+}
+
+type firewall struct {
+	Table string // nftables表名, 默认keep_vip
+	Rules []struct {
+		Name  string
+		Chain string // prerouting|input|forward|output|postrouting
+		Rule  string // nft规则语句
+	}
+}
+
+// Check - 检查配置, 节点检查和负载均衡后端检查共用
+type Check struct {
+	Name      string
+	Address   string
+	Protocol  string // tcp|http|https|exec|udp|dns|icmp|grpc|postgres|mysql|redis|tls
+	Timeout   int
+	Interval  int       // 单位s, 检查间隔(默认:ChecksInterval)
+	Rise      int       // 连续成功次数, 达到后状态变为passing(默认:1)
+	Fall      int       // 连续失败次数, 达到后状态变为failing(默认:1)
+	HoldDown  int       // 单位s, 状态变化后该时间内不再变化
+	Weight    int       // 不为0时不会退出程序, 只调整节点分数. 大于0时passing加分, 小于0时failing减分
+	DependsOn []string  `mapstructure:"depends_on"` // 依赖的检查或检查组, 任意一个failing时跳过检查
+	HTTP      httpCheck // protocol为http|https时有效
+	Exec      execCheck // protocol为exec时有效
+	UDP       udpCheck  // protocol为udp时有效
+	DNS       dnsCheck  // protocol为dns时有效, address为DNS服务器
+	ICMP      icmpCheck // protocol为icmp时有效, address为主机名或IP地址
+	GRPC      grpcCheck // protocol为grpc时有效
+	Database  dbCheck   // protocol为postgres|mysql|redis时有效
+	TLS       tlsCheck  // protocol为tls时有效
+}
+
+type checkGroup struct {
+	Name   string
+	Mode   string   // all|any|quorum(n)(默认:all)
+	Checks []string // 检查或检查组名称
+}
+
+type tlsCheck struct {
+	InsecureSkipVerify bool
+	ServerName         string // SNI, 为空使用address中的主机名
+	CaFile             string // CA证书, 为空使用系统CA
+	CertFile           string
+	KeyFile            string
+	WarnDays           int // 证书剩余有效天数少于该值时输出警告
+	FailDays           int // 证书剩余有效天数少于该值时检查失败
+}
+
+type dbCheck struct {
+	User     string // Redis为空时使用AUTH password
+	Password string
+	Database string // Redis无效
+	Role     string // 期望的角色: primary|replica(默认:primary)
+	SSLMode  string // 仅PostgreSQL有效: disable|prefer|require|verify-ca|verify-full(默认:prefer)
+}
+
+type udpCheck struct {
+	Payload        string
+	PayloadHex     string // 十六进制, 优先于payload
+	ExpectReply    bool
+	ExpectContains string
+}
+
+type dnsCheck struct {
+	Name   string
+	Type   string   // A|AAAA|CNAME|TXT, 默认A
+	Expect []string // 期望的应答, 为空时只要求应答不为空
+}
+
+type grpcCheck struct {
+	Service   string // 为空检查整个服务端
+	TLS       bool
+	TLSConfig tlsConfig
+}
+
+type icmpCheck struct {
+	Count   int // 默认3
+	MaxLoss int // 最大丢包率(%)
+	MaxRtt  int // 最大平均延迟(ms), 0不限制
+}
+
+type execCheck struct {
+	Command   string
+	Args      []string
+	Env       []string // KEY=VALUE, viper会将map的key转为小写, 所以使用列表
+	Dir       string
+	MaxOutput int // 最多保留的输出字节数, 默认4096
+}
+
+type httpCheck struct {
+	Method       string
+	Path         string
+	Host         string
+	Headers      map[string]string
+	ExpectStatus []string // 期望的状态码, 例如: 200, 200-299, 3xx. 默认200-399
+	BodyContains string
+	BodyRegex    string
+	TLS          tlsConfig
+}
+
+// tlsConfig - 字段与health.TLSOptions保持一致
+type tlsConfig struct {
+	InsecureSkipVerify bool
+	ServerName         string // SNI
+	CaFile             string
+	CertFile           string // 客户端证书
+	KeyFile            string
+}
+
+type syncGroup struct {
+	Name   string
+	Vips   []vip    // 组内VIP, 可以绑定到不同网络接口
+	Checks []string // 跟踪的检查名称, 任意一个失败整组迁移
+}
+
+type vip struct {
+	Address   string
+	Interface string
+	Netns     string // 为空时使用顶层netns
+	Mode      string // 为空时使用顶层mode
+	Route     route  // mode为route时有效, 为空时使用顶层route
+}
+
+type route struct {
+	Table        int // 路由表(默认:main)
+	RulePriority int // 大于0时添加策略路由: to vip lookup table
 }
 
 type member struct {
-	ID      string // 集群内唯一标识
-	Address string // IP地址
+	ID         string // 集群内唯一标识
+	Address    string // IP地址
+	Priority   int    // 节点优先级(默认:100), 加上加权检查的权重为节点分数
+	APIAddress string // 成员接口地址, Leader通过该接口获取成员分数, 为空不参与分数比较
 }
 
 type loadBalancers struct {
 	Name        string
 	BindAddress string
-	Type        string
-	Backends    []struct {
-		Name    string
-		Address string
-	}
+	Type        string      // tcp|udp|http
+	IdleTimeout int         // 单位s, udp会话空闲超时(默认:30)
+	MaxFlows    int         // udp会话数上限(默认:10000), 达到上限时丢弃新客户端的报文
+	Algorithm   string      // 负载均衡算法: roundrobin|leastconn|p2c|sourcehash(默认:roundrobin)
+	Check       Check       // 后端主动检查, protocol为空不检查. 不能配置address, 使用后端地址
+	Passive     passive     // 后端被动检查
+	Retry       retry       // 拨号后端的重试策略
+	HTTP        httpProxy   // http代理配置
+	Routes      []httpRoute // http路由, 按顺序匹配, 没有匹配时使用backends
+	Pools       []pool      // http路由的后端池, 使用负载均衡的检查和重试策略
+	Backends    []Backend
+}
+
+// Backend - 负载均衡后端
+type Backend struct {
+	Name    string
+	Address string
+	Weight  int // 权重(默认:1)
+}
+
+type httpProxy struct {
+	Timeout  int // 单位s, 请求超时, 不包括websocket(默认:60)
+	CertFile string
+	KeyFile  string
+}
+
+type httpRoute struct {
+	Host string // 为空匹配所有, 支持*.example.com
+	Path string // 路径前缀, 按路径段匹配, /api不匹配/apiv2
+	Pool string // 为空使用backends
+}
+
+type pool struct {
+	Name      string
+	Algorithm string
+	Backends  []Backend
+}
+
+type retry struct {
+	ConnectTimeout int // 单位ms, 单次拨号超时(默认:500)
+	MaxAttempts    int // 最大尝试次数(默认:3)
+	Backoff        int // 单位ms, 两次尝试的间隔, 每次翻倍(默认:100)
+	Deadline       int // 单位ms, 所有尝试的总时间(默认:3000)
+}
+
+type passive struct {
+	MaxFails  int // 连续拨号失败次数, 达到后摘除后端, 0不摘除
+	EjectTime int // 单位s, 摘除时间(默认:30)
 }